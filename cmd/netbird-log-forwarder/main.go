@@ -2,58 +2,87 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/NorskHelsenett/netbird-log-forwarder/cmd/settings"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/alerting"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/backfill"
 	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/netbird"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/dedup"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/expr"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/fieldset"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/filter"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/flows"
 	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/nat"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/poller"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/queue"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/schema"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/sinks"
 	"github.com/NorskHelsenett/netbird-log-forwarder/internal/webserver"
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
 func main() {
-	configFile, err := settings.InitConfig("./config.yaml")
-	if err != nil {
-		fmt.Printf("config init failed: %v", err)
-	}
-	fmt.Printf("Config file %s loaded successfully", configFile)
-
-	secretsFile, err := settings.InitSecrets("./secrets.yaml")
-	if err != nil {
-		fmt.Printf("secrets init failed: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		os.Exit(runBackfill(os.Args[2:]))
 	}
-	fmt.Printf("Secrets file %s loaded successfully", secretsFile)
 
-	if err := logger.InitLogger("./logs"); err != nil {
-		log.Fatalf("logger init failed: %v", err)
-	}
-	logger.Log.Infoln("Zap logger initialized successfully")
+	initCommon(false)
 
-	netbirdToken := viper.GetString("netbird.token")
-	err = netbird.NewUserCache(netbirdToken)
-	if err != nil {
-		logger.Log.Errorf("Failed to initialize user cache: %v\n", err)
+	// Alerting is only loaded here, so backfill never notifies about
+	// historical events.
+	if err := alerting.Load(); err != nil {
+		logger.Log.Errorf("Failed to load alerting rules: %v\n", err)
 		os.Exit(1)
 	}
 
-	err = netbird.NewPeerCache(netbirdToken)
-	if err != nil {
-		logger.Log.Errorf("Failed to initialize peer cache: %v\n", err)
-		os.Exit(1)
+	queue.InitQueue(viper.GetInt("queue.size"), viper.GetInt("queue.workers"))
+	// The poller re-reads its overlap window every interval, and in both mode
+	// the webhook delivers the same events too.
+	if settings.PullEnabled() {
+		ttl := viper.GetDuration("pull.dedup_ttl")
+		overlap := viper.GetDuration("pull.overlap")
+		if overlap <= 0 {
+			overlap = 5 * time.Minute // pollerens standard
+		}
+		if ttl <= overlap {
+			logger.Log.Warnf("pull.dedup_ttl (%s) is not longer than pull.overlap (%s), overlapping traffic events will be sent again", ttl, overlap)
+		}
+		queue.GlobalQueue.EnableDedup(ttl)
 	}
 
 	// Watch for config changes
 	viper.WatchConfig()
 	viper.OnConfigChange(func(e fsnotify.Event) {
 		logger.Log.Infof("Config reloaded: %s", e.Name)
-		_, _ = settings.InitConfig("./config.yaml")
-		if err != nil {
-			log.Fatalf("Config reload failed: %v", err)
+		if _, err := settings.InitConfig("./config.yaml"); err != nil {
+			logger.Log.Errorf("Config reload failed: %v", err)
+			return
+		}
+		if err := filter.Load(); err != nil {
+			logger.Log.Errorf("Filter reload failed, keeping previous rules: %v", err)
+		}
+		if err := expr.Load(); err != nil {
+			logger.Log.Errorf("Expression reload failed, keeping previous expressions: %v", err)
+		}
+		if err := alerting.Load(); err != nil {
+			logger.Log.Errorf("Alerting reload failed, keeping previous rules: %v", err)
+		}
+		if err := nat.Load(); err != nil {
+			logger.Log.Errorf("NAT reload failed, keeping previous rules: %v", err)
+		}
+		if err := fieldset.Load(); err != nil {
+			logger.Log.Errorf("Output field reload failed, keeping previous fields: %v", err)
 		}
 	})
 
@@ -62,15 +91,211 @@ func main() {
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	// Start web server in a goroutine
-	_, serverCancel := context.WithCancel(context.Background())
+	serverCtx, serverCancel := context.WithCancel(context.Background())
+	netbird.RunAll(serverCtx)
+	if dedup.GlobalDeduper != nil {
+		go dedup.GlobalDeduper.Run(serverCtx)
+	}
+	if flows.GlobalAggregator != nil {
+		go flows.GlobalAggregator.Run(serverCtx)
+	}
+
 	auth_token := viper.GetString("api.auth_token")
 	go func() {
 		webserver.InitHttpServer(auth_token)
 	}()
 
+	if settings.PullEnabled() {
+		p, err := poller.NewPoller(netbirdapi.GlobalClient, poller.Config{
+			Interval:  viper.GetDuration("pull.interval"),
+			StateFile: viper.GetString("pull.state_file"),
+			PageSize:  viper.GetInt("pull.page_size"),
+			Lookback:  viper.GetDuration("pull.lookback"),
+			Overlap:   viper.GetDuration("pull.overlap"),
+		})
+		if err != nil {
+			logger.Log.Errorf("Failed to initialize poller: %v\n", err)
+			os.Exit(1)
+		}
+		go p.Run(serverCtx)
+		logger.Log.Infof("Polling NetBird events every %s", viper.GetDuration("pull.interval"))
+	}
+
 	// Wait for termination signal
 	sig := <-sigChan
 	logger.Log.Infof("Received signal: %s. Shutting down...", sig)
 	serverCancel()
 
+	queue.GlobalQueue.Close()
+	alertCtx, alertCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := alerting.Close(alertCtx); err != nil {
+		logger.Log.Errorf("Failed to send queued alerts: %v", err)
+	}
+	alertCancel()
+	if dedup.GlobalDeduper != nil {
+		dedup.GlobalDeduper.Close()
+	}
+	if flows.GlobalAggregator != nil {
+		flows.GlobalAggregator.Close()
+	}
+	if err := sinks.GlobalSinks.Close(); err != nil {
+		logger.Log.Errorf("Failed to close sinks: %v", err)
+	}
+	logger.Sync()
+}
+
+// initCommon loads config, secrets, logger, sinks, caches and rules shared by
+// the server and the backfill command. With dryRun, events are printed to
+// stdout instead of being sent to the configured sinks.
+func initCommon(dryRun bool) {
+	configFile, err := settings.InitConfig("./config.yaml")
+	if err != nil {
+		fmt.Printf("config init failed: %v", err)
+	}
+	fmt.Fprintf(logger.Console, "Config file %s loaded successfully", configFile)
+
+	secretsFile, err := settings.InitSecrets("./secrets.yaml")
+	if err != nil {
+		fmt.Printf("secrets init failed: %v", err)
+	}
+	fmt.Fprintf(logger.Console, "Secrets file %s loaded successfully", secretsFile)
+
+	if err := logger.InitLogger("./logs"); err != nil {
+		log.Fatalf("logger init failed: %v", err)
+	}
+	logger.Log.Infoln("Zap logger initialized successfully")
+
+	if dryRun {
+		// Vis det Splunk ville fått, i samme profil.
+		profile, err := schema.Lookup(viper.GetString("splunk.profile"))
+		if err != nil {
+			logger.Log.Errorf("Failed to initialize sinks: %v\n", err)
+			os.Exit(1)
+		}
+		sinks.GlobalSinks = sinks.NewMultiSink(sinks.NewWriterSink(os.Stdout, profile))
+	} else if err := sinks.InitSinks(); err != nil {
+		logger.Log.Errorf("Failed to initialize sinks: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := netbirdapi.InitClient(viper.GetString("netbird.token")); err != nil {
+		logger.Log.Errorf("Failed to initialize NetBird API client: %v\n", err)
+		os.Exit(1)
+	}
+	logger.Log.Infof("Using NetBird management API at %s", netbirdapi.GlobalClient.BaseURL())
+
+	// A cache that cannot be loaded starts empty and stale, and keeps
+	// retrying in the background. The caches load in parallel, so an API
+	// outage delays startup by cache.startup_timeout at most.
+	caches := []struct {
+		name    string
+		newFunc func(*netbirdapi.Client) error
+	}{
+		{"user", netbird.NewUserCache},
+		{"peer", netbird.NewPeerCache},
+		{"group", netbird.NewGroupCache},
+		{"policy", netbird.NewPolicyCache},
+		{"route", netbird.NewRouteCache},
+		{"network", netbird.NewNetworkCache},
+		{"network resource", netbird.NewResourceCache},
+		{"nameserver group", netbird.NewNameserverGroupCache},
+		{"posture check", netbird.NewPostureCheckCache},
+		{"setup key", netbird.NewSetupKeyCache},
+	}
+	var wg sync.WaitGroup
+	for _, c := range caches {
+		wg.Go(func() {
+			if err := c.newFunc(netbirdapi.GlobalClient); err != nil {
+				logger.Log.Warnf("Failed to initialize %s cache: %v", c.name, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if err := filter.Load(); err != nil {
+		logger.Log.Errorf("Failed to load filter rules: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := expr.Load(); err != nil {
+		logger.Log.Errorf("Failed to compile expressions: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := nat.Load(); err != nil {
+		logger.Log.Errorf("Failed to load NAT rules: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := fieldset.Load(); err != nil {
+		logger.Log.Errorf("Failed to load output fields: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := dedup.Init(); err != nil {
+		logger.Log.Errorf("Failed to initialize traffic de-duplication: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := flows.Init(); err != nil {
+		logger.Log.Errorf("Failed to initialize flow aggregation: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runBackfill implements "netbird-log-forwarder backfill".
+func runBackfill(args []string) int {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	from := flags.String("from", "", "start of the range, RFC3339 (required)")
+	to := flags.String("to", "", "end of the range, RFC3339 (default now, or the end of the run being resumed)")
+	kind := flags.String("kind", "all", "event kind: traffic, audit or all")
+	checkpoint := flags.String("checkpoint", "./state/backfill.json", "checkpoint file used to resume an interrupted run")
+	pageSize := flags.Int("page-size", 500, "traffic events per API page")
+	dryRun := flags.Bool("dry-run", false, "print the events that would be sent instead of sending them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := backfill.Options{
+		Kind:       *kind,
+		Checkpoint: *checkpoint,
+		PageSize:   *pageSize,
+		DryRun:     *dryRun,
+	}
+	var err error
+	if opts.From, err = time.Parse(time.RFC3339, *from); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid --from %q: %v\n", *from, err)
+		return 2
+	}
+	if *to != "" {
+		if opts.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --to %q: %v\n", *to, err)
+			return 2
+		}
+	}
+
+	if opts.DryRun {
+		logger.Console = os.Stderr
+	}
+	initCommon(opts.DryRun)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	err = backfill.Run(ctx, netbirdapi.GlobalClient, opts)
+	if dedup.GlobalDeduper != nil {
+		dedup.GlobalDeduper.Close()
+	}
+	if flows.GlobalAggregator != nil {
+		flows.GlobalAggregator.Close()
+	}
+	if closeErr := sinks.GlobalSinks.Close(); closeErr != nil {
+		logger.Log.Errorf("Failed to close sinks: %v", closeErr)
+	}
+	logger.Sync()
+	if err != nil {
+		logger.Log.Errorf("Backfill failed: %v", err)
+		return 1
+	}
+	return 0
 }
@@ -13,6 +13,8 @@ func InitConfig(config_path string) (string, error) {
 		return "", fmt.Errorf("resolve config path: %w", err)
 	}
 
+	setDefaults()
+
 	viper.SetConfigFile(abs)
 	if err := viper.ReadInConfig(); err != nil {
 		return "", fmt.Errorf("failed to read config %s: %w", abs, err)
@@ -34,3 +36,41 @@ func InitSecrets(secrets_path string) (string, error) {
 
 	return viper.ConfigFileUsed(), nil
 }
+
+func setDefaults() {
+	viper.SetDefault("netbird.api_url", "https://api.netbird.io")
+	viper.SetDefault("netbird.timeout", "30s")
+	viper.SetDefault("cache.refresh_interval", "5m")
+	viper.SetDefault("cache.negative_ttl", "10m")
+	viper.SetDefault("cache.min_miss_refresh", "30s")
+	viper.SetDefault("cache.snapshot_dir", "./state/cache")
+	viper.SetDefault("cache.startup_timeout", "15s")
+	viper.SetDefault("splunk.batch.gzip", true)
+	viper.SetDefault("dedup.window", "30s")
+	viper.SetDefault("dedup.key", "tuple")
+	viper.SetDefault("dedup.max_entries", 100000)
+	viper.SetDefault("flows.idle_timeout", "5m")
+	viper.SetDefault("flows.late_window", "1m")
+	viper.SetDefault("flows.max_flows", 100000)
+	viper.SetDefault("flows.emit_raw", true)
+	viper.SetDefault("queue.size", 10000)
+	viper.SetDefault("queue.workers", 4)
+	viper.SetDefault("queue.retry_after", "5s")
+	viper.SetDefault("queue.full_status", 429)
+	viper.SetDefault("mode", "push")
+	viper.SetDefault("pull.interval", "30s")
+	viper.SetDefault("pull.state_file", "./state/poller.json")
+	viper.SetDefault("pull.dedup_ttl", "1h")
+}
+
+// PushEnabled reports whether the webhook endpoint should accept events.
+func PushEnabled() bool {
+	mode := viper.GetString("mode")
+	return mode == "push" || mode == "both"
+}
+
+// PullEnabled reports whether events should be polled from the NetBird API.
+func PullEnabled() bool {
+	mode := viper.GetString("mode")
+	return mode == "pull" || mode == "both"
+}
@@ -0,0 +1,264 @@
+package activity
+
+import "strings"
+
+// TargetType is the kind of NetBird object an audit event's target_id
+// refers to.
+type TargetType string
+
+const (
+	TargetUnknown         TargetType = ""
+	TargetAccount         TargetType = "account"
+	TargetUser            TargetType = "user"
+	TargetPeer            TargetType = "peer"
+	TargetGroup           TargetType = "group"
+	TargetPolicy          TargetType = "policy"
+	TargetRule            TargetType = "rule"
+	TargetSetupKey        TargetType = "setup_key"
+	TargetRoute           TargetType = "route"
+	TargetNameserverGroup TargetType = "nameserver_group"
+	TargetPostureCheck    TargetType = "posture_check"
+	TargetNetwork         TargetType = "network"
+	TargetNetworkResource TargetType = "network_resource"
+	TargetNetworkRouter   TargetType = "network_router"
+	TargetIntegration     TargetType = "integration"
+	TargetAccessToken     TargetType = "personal_access_token"
+)
+
+type Category string
+
+const (
+	CategoryUnknown  Category = "unknown"
+	CategoryAuth     Category = "auth"
+	CategoryPeer     Category = "peer_lifecycle"
+	CategoryPolicy   Category = "policy_change"
+	CategoryUser     Category = "user_management"
+	CategorySetupKey Category = "setup_keys"
+	CategoryDNS      Category = "dns"
+	CategoryRoutes   Category = "routes"
+	CategorySettings Category = "settings"
+)
+
+type Severity string
+
+const (
+	SeverityInfo   Severity = "info"
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// Activity describes one NetBird audit activity.
+type Activity struct {
+	Code     string
+	Message  string
+	Target   TargetType
+	Category Category
+	Severity Severity
+	Action   string // derived from the last part of Code
+}
+
+// Unknown is returned for activities that are not in the catalog. They get a
+// medium severity so new NetBird activities are not silently ignored.
+var Unknown = Activity{Category: CategoryUnknown, Severity: SeverityMedium, Action: "unknown"}
+
+type entry struct {
+	code     string
+	message  string
+	target   TargetType
+	category Category
+	severity Severity
+}
+
+// catalog follows the activity codes in NetBird's management/server/activity.
+var catalog = []entry{
+	{"account.create", "Account created", TargetAccount, CategorySettings, SeverityLow},
+	{"account.delete", "Account deleted", TargetAccount, CategorySettings, SeverityHigh},
+	{"account.setting.peer.login.expiration.enable", "Account peer login expiration enabled", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.peer.login.expiration.disable", "Account peer login expiration disabled", TargetAccount, CategorySettings, SeverityHigh},
+	{"account.setting.peer.login.expiration.update", "Account peer login expiration duration updated", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.peer.inactivity.expiration.enable", "Account peer inactivity expiration enabled", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.peer.inactivity.expiration.disable", "Account peer inactivity expiration disabled", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.peer.inactivity.expiration.update", "Account peer inactivity expiration duration updated", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.peer.approval.enable", "Account peer approval enabled", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.peer.approval.disable", "Account peer approval disabled", TargetAccount, CategorySettings, SeverityHigh},
+	{"account.setting.group.propagation.enable", "Account group propagation enabled", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.group.propagation.disable", "Account group propagation disabled", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.routing.peer.dns.resolution.enable", "Account routing peer DNS resolution enabled", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.routing.peer.dns.resolution.disable", "Account routing peer DNS resolution disabled", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.lazy.connection.enable", "Account lazy connection enabled", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.setting.lazy.connection.disable", "Account lazy connection disabled", TargetAccount, CategorySettings, SeverityMedium},
+	{"account.network.range.update", "Account network range updated", TargetAccount, CategorySettings, SeverityHigh},
+	{"account.dns.domain.update", "Account DNS domain updated", TargetAccount, CategoryDNS, SeverityMedium},
+
+	{"dashboard.login", "Dashboard login", TargetUser, CategoryAuth, SeverityInfo},
+	{"user.join", "User joined", TargetUser, CategoryUser, SeverityInfo},
+	{"user.invite", "User invited", TargetUser, CategoryUser, SeverityLow},
+	{"user.create", "User created", TargetUser, CategoryUser, SeverityLow},
+	{"user.delete", "User deleted", TargetUser, CategoryUser, SeverityHigh},
+	{"user.block", "User blocked", TargetUser, CategoryUser, SeverityHigh},
+	{"user.unblock", "User unblocked", TargetUser, CategoryUser, SeverityLow},
+	{"user.approve", "User approved", TargetUser, CategoryUser, SeverityLow},
+	{"user.reject", "User rejected", TargetUser, CategoryUser, SeverityLow},
+	{"user.role.update", "User role updated", TargetUser, CategoryUser, SeverityHigh},
+	{"user.group.add", "Group added to user", TargetUser, CategoryUser, SeverityMedium},
+	{"user.group.delete", "Group removed from user", TargetUser, CategoryUser, SeverityMedium},
+	{"user.password.change", "User password changed", TargetUser, CategoryAuth, SeverityLow},
+	{"transferred.owner.role", "Transferred owner role", TargetUser, CategoryUser, SeverityHigh},
+	{"service.user.create", "Service user created", TargetUser, CategoryUser, SeverityHigh},
+	{"service.user.delete", "Service user deleted", TargetUser, CategoryUser, SeverityLow},
+	{"personal.access.token.create", "Personal access token created", TargetAccessToken, CategoryAuth, SeverityHigh},
+	{"personal.access.token.delete", "Personal access token deleted", TargetAccessToken, CategoryAuth, SeverityLow},
+
+	{"user.peer.add", "Peer added", TargetPeer, CategoryPeer, SeverityLow},
+	{"setupkey.peer.add", "Peer added", TargetPeer, CategoryPeer, SeverityLow},
+	{"user.peer.delete", "Peer deleted", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.rename", "Peer renamed", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.ip.update", "Peer IP updated", TargetPeer, CategoryPeer, SeverityLow},
+	{"user.peer.login", "User logged in peer", TargetPeer, CategoryAuth, SeverityInfo},
+	{"peer.login.expire", "Peer login expired", TargetPeer, CategoryAuth, SeverityInfo},
+	{"peer.login.expiration.enable", "Peer login expiration enabled", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.login.expiration.disable", "Peer login expiration disabled", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.inactivity.expiration.enable", "Peer inactivity expiration enabled", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.inactivity.expiration.disable", "Peer inactivity expiration disabled", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.ssh.enable", "Peer SSH server enabled", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.ssh.disable", "Peer SSH server disabled", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.approve", "Peer approved", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.approval.revoke", "Peer approval revoked", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.group.add", "Group added to peer", TargetPeer, CategoryPeer, SeverityLow},
+	{"peer.group.delete", "Group removed from peer", TargetPeer, CategoryPeer, SeverityLow},
+
+	{"group.add", "Group created", TargetGroup, CategoryPolicy, SeverityMedium},
+	{"group.update", "Group updated", TargetGroup, CategoryPolicy, SeverityMedium},
+	{"group.delete", "Group deleted", TargetGroup, CategoryPolicy, SeverityHigh},
+	{"resource.group.add", "Group added to resource", TargetGroup, CategoryPolicy, SeverityMedium},
+	{"resource.group.delete", "Group removed from resource", TargetGroup, CategoryPolicy, SeverityMedium},
+	{"dns.setting.disabled.management.group.add", "Group added to disabled management DNS setting", TargetGroup, CategoryDNS, SeverityHigh},
+	{"dns.setting.disabled.management.group.delete", "Group removed from disabled management DNS setting", TargetGroup, CategoryDNS, SeverityMedium},
+
+	{"policy.add", "Policy added", TargetPolicy, CategoryPolicy, SeverityMedium},
+	{"policy.update", "Policy updated", TargetPolicy, CategoryPolicy, SeverityMedium},
+	{"policy.delete", "Policy deleted", TargetPolicy, CategoryPolicy, SeverityHigh},
+	{"rule.add", "Rule added", TargetRule, CategoryPolicy, SeverityMedium},
+	{"rule.update", "Rule updated", TargetRule, CategoryPolicy, SeverityMedium},
+	{"rule.delete", "Rule deleted", TargetRule, CategoryPolicy, SeverityHigh},
+
+	{"setupkey.add", "Setup key created", TargetSetupKey, CategorySetupKey, SeverityMedium},
+	{"setupkey.update", "Setup key updated", TargetSetupKey, CategorySetupKey, SeverityMedium},
+	{"setupkey.revoke", "Setup key revoked", TargetSetupKey, CategorySetupKey, SeverityMedium},
+	{"setupkey.overuse", "Setup key overused", TargetSetupKey, CategorySetupKey, SeverityHigh},
+	{"setupkey.delete", "Setup key deleted", TargetSetupKey, CategorySetupKey, SeverityMedium},
+	{"setupkey.group.add", "Group added to setup key", TargetSetupKey, CategorySetupKey, SeverityMedium},
+	{"setupkey.group.delete", "Group removed from setup key", TargetSetupKey, CategorySetupKey, SeverityMedium},
+
+	{"route.add", "Route created", TargetRoute, CategoryRoutes, SeverityMedium},
+	{"route.update", "Route updated", TargetRoute, CategoryRoutes, SeverityMedium},
+	{"route.delete", "Route deleted", TargetRoute, CategoryRoutes, SeverityHigh},
+
+	{"nameserver.group.add", "Nameserver group created", TargetNameserverGroup, CategoryDNS, SeverityMedium},
+	{"nameserver.group.update", "Nameserver group updated", TargetNameserverGroup, CategoryDNS, SeverityMedium},
+	{"nameserver.group.delete", "Nameserver group deleted", TargetNameserverGroup, CategoryDNS, SeverityHigh},
+
+	{"posture.check.create", "Posture check created", TargetPostureCheck, CategoryPolicy, SeverityMedium},
+	{"posture.check.update", "Posture check updated", TargetPostureCheck, CategoryPolicy, SeverityMedium},
+	{"posture.check.delete", "Posture check deleted", TargetPostureCheck, CategoryPolicy, SeverityHigh},
+
+	{"network.create", "Network created", TargetNetwork, CategoryRoutes, SeverityMedium},
+	{"network.update", "Network updated", TargetNetwork, CategoryRoutes, SeverityMedium},
+	{"network.delete", "Network deleted", TargetNetwork, CategoryRoutes, SeverityHigh},
+	{"network.resource.create", "Network resource created", TargetNetworkResource, CategoryRoutes, SeverityMedium},
+	{"network.resource.update", "Network resource updated", TargetNetworkResource, CategoryRoutes, SeverityMedium},
+	{"network.resource.delete", "Network resource deleted", TargetNetworkResource, CategoryRoutes, SeverityMedium},
+	{"network.router.create", "Network router created", TargetNetworkRouter, CategoryRoutes, SeverityMedium},
+	{"network.router.update", "Network router updated", TargetNetworkRouter, CategoryRoutes, SeverityMedium},
+	{"network.router.delete", "Network router deleted", TargetNetworkRouter, CategoryRoutes, SeverityMedium},
+
+	{"integration.create", "Integration created", TargetIntegration, CategorySettings, SeverityMedium},
+	{"integration.update", "Integration updated", TargetIntegration, CategorySettings, SeverityMedium},
+	{"integration.delete", "Integration deleted", TargetIntegration, CategorySettings, SeverityHigh},
+}
+
+var (
+	byCode    = map[string]Activity{}
+	byMessage = map[string]Activity{}
+	// shared lists the codes of messages used by more than one activity.
+	// Those can only be identified by code.
+	shared = map[string][]string{}
+)
+
+// actions maps the last segment of an activity code to an action verb.
+var actions = map[string]string{
+	"add":     "create",
+	"create":  "create",
+	"join":    "create",
+	"invite":  "create",
+	"delete":  "delete",
+	"update":  "update",
+	"rename":  "update",
+	"change":  "update",
+	"role":    "update",
+	"enable":  "enable",
+	"disable": "disable",
+	"login":   "login",
+	"expire":  "expire",
+	"block":   "block",
+	"unblock": "unblock",
+	"approve": "approve",
+	"reject":  "reject",
+	"revoke":  "revoke",
+	"overuse": "overuse",
+}
+
+func init() {
+	for _, e := range catalog {
+		a := Activity{
+			Code:     e.code,
+			Message:  e.message,
+			Target:   e.target,
+			Category: e.category,
+			Severity: e.severity,
+			Action:   actions[e.code[strings.LastIndex(e.code, ".")+1:]],
+		}
+		byCode[a.Code] = a
+
+		msg := strings.ToLower(a.Message)
+		if first, exists := byMessage[msg]; exists {
+			if len(shared[msg]) == 0 {
+				shared[msg] = []string{first.Code}
+			}
+			shared[msg] = append(shared[msg], a.Code)
+			continue
+		}
+		byMessage[msg] = a
+	}
+	for msg := range shared {
+		delete(byMessage, msg)
+	}
+}
+
+// Lookup finds an activity by code, falling back to the message text since
+// webhook payloads do not always carry the code. Unknown activities, and
+// messages shared by several activities, return Unknown with the given code
+// and message filled in, and false.
+func Lookup(code, message string) (Activity, bool) {
+	if a, ok := byCode[code]; ok {
+		return a, true
+	}
+	if a, ok := byMessage[normalize(message)]; ok {
+		return a, true
+	}
+	a := Unknown
+	a.Code = code
+	a.Message = message
+	return a, false
+}
+
+// Candidates returns the codes of the activities that share message, or nil
+// when the message identifies a single activity or none.
+func Candidates(message string) []string {
+	return shared[normalize(message)]
+}
+
+func normalize(message string) string {
+	return strings.ToLower(strings.TrimSpace(message))
+}
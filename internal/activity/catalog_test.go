@@ -0,0 +1,90 @@
+package activity
+
+import (
+	"slices"
+	"testing"
+)
+
+// Every catalog entry must classify fully, or it ends up looking like an
+// unknown activity in the sinks.
+func TestCatalogIsComplete(t *testing.T) {
+	seen := map[string]bool{}
+	for _, e := range catalog {
+		if seen[e.code] {
+			t.Errorf("%s listed twice", e.code)
+		}
+		seen[e.code] = true
+
+		a := byCode[e.code]
+		if a.Action == "" {
+			t.Errorf("%s has no action", e.code)
+		}
+		if a.Target == TargetUnknown || a.Category == "" || a.Category == CategoryUnknown {
+			t.Errorf("%s has target %q and category %q", e.code, a.Target, a.Category)
+		}
+		switch a.Severity {
+		case SeverityInfo, SeverityLow, SeverityMedium, SeverityHigh:
+		default:
+			t.Errorf("%s has severity %q", e.code, a.Severity)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		message    string
+		wantCode   string
+		wantAction string
+		wantFound  bool
+	}{
+		{"by code", "user.block", "", "user.block", "block", true},
+		{"code wins over message", "group.add", "Policy added", "group.add", "create", true},
+		{"by message", "", "Setup key revoked", "setupkey.revoke", "revoke", true},
+		{"message is case and space insensitive", "", "  user ROLE updated ", "user.role.update", "update", true},
+		{"peer added by a user", "user.peer.add", "Peer added", "user.peer.add", "create", true},
+		{"peer added with a setup key", "setupkey.peer.add", "Peer added", "setupkey.peer.add", "create", true},
+		{"shared message without code is unknown", "", "Peer added", "", "unknown", false},
+		{"unknown", "peer.teleport", "Peer teleported", "peer.teleport", "unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, found := Lookup(tt.code, tt.message)
+			if found != tt.wantFound || a.Code != tt.wantCode || a.Action != tt.wantAction {
+				t.Errorf("Lookup = %s/%s, %t; want %s/%s, %t", a.Code, a.Action, found, tt.wantCode, tt.wantAction, tt.wantFound)
+			}
+		})
+	}
+
+	a, _ := Lookup("peer.teleport", "Peer teleported")
+	if a.Message != "Peer teleported" || a.Category != CategoryUnknown || a.Severity != SeverityMedium {
+		t.Errorf("unknown activity = %+v", a)
+	}
+}
+
+// A message shared by several activities must never resolve to one of them.
+func TestSharedMessages(t *testing.T) {
+	messages := map[string][]string{}
+	for _, e := range catalog {
+		msg := normalize(e.message)
+		messages[msg] = append(messages[msg], e.code)
+	}
+	for msg, codes := range messages {
+		if len(codes) == 1 {
+			if got := Candidates(msg); got != nil {
+				t.Errorf("Candidates(%q) = %v for a unique message", msg, got)
+			}
+			continue
+		}
+		if a, found := Lookup("", msg); found {
+			t.Errorf("Lookup(%q) = %s, want unknown since it is shared by %v", msg, a.Code, codes)
+		}
+		if got := Candidates(msg); !slices.Equal(got, codes) {
+			t.Errorf("Candidates(%q) = %v, want %v", msg, got, codes)
+		}
+	}
+	if got := Candidates("Peer added"); !slices.Equal(got, []string{"user.peer.add", "setupkey.peer.add"}) {
+		t.Errorf("Candidates(Peer added) = %v", got)
+	}
+}
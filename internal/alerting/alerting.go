@@ -0,0 +1,441 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/metrics"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/viper"
+)
+
+// DefaultTemplate renders a {"text": ...} payload, which both Slack and
+// Microsoft Teams incoming webhooks accept.
+const DefaultTemplate = `{"text": {{ printf "[%s] %s: %s by %s (%s %s)%s" .Severity .Rule .Message .Initiator .TargetType .Target .SuppressedNote | json }}}`
+
+// Config is the alerting section of config.yaml.
+type Config struct {
+	WebhookURL string        `mapstructure:"webhook_url"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+	// MaxAge skips events older than this, so a backfill or a replayed
+	// backlog does not page anyone.
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// QueueSize is the number of alerts waiting for delivery before new
+	// ones are dropped. It is read once, at the first load.
+	QueueSize int    `mapstructure:"queue_size"`
+	Rules     []Rule `mapstructure:"rules"`
+}
+
+type Rule struct {
+	Name string `mapstructure:"name"`
+	// WebhookURL overrides the shared webhook for this rule.
+	WebhookURL string `mapstructure:"webhook_url"`
+	// Throttle is the minimum time between two alerts from this rule.
+	// Alerts in between are counted and reported with the next one.
+	Throttle time.Duration `mapstructure:"throttle"`
+	Template string        `mapstructure:"template"`
+	Match    Match         `mapstructure:"match"`
+}
+
+// Match lists the conditions of a rule. Empty lists match anything, values
+// within a list are OR'ed and the conditions are AND'ed together. All values
+// accept shell-style globs and compare case-insensitively.
+type Match struct {
+	ActivityCodes []string `mapstructure:"activity_codes"`
+	Categories    []string `mapstructure:"categories"`
+	Severities    []string `mapstructure:"severities"`
+	Messages      []string `mapstructure:"messages"`
+	TargetTypes   []string `mapstructure:"target_types"`
+	Initiators    []string `mapstructure:"initiators"`
+	// Meta matches fields of the event meta, e.g. role: admin.
+	Meta map[string]string `mapstructure:"meta"`
+}
+
+// Alert is the data available to templates.
+type Alert struct {
+	Rule       string
+	Time       time.Time
+	Message    string
+	Code       string
+	Category   string
+	Action     string
+	Severity   string
+	Initiator  string
+	TargetID   string
+	TargetType string
+	Target     string
+	Meta       map[string]any
+	// Suppressed is the number of alerts throttled since the last one sent.
+	Suppressed     int
+	SuppressedNote string
+}
+
+type compiledRule struct {
+	name       string
+	webhookURL string
+	throttle   time.Duration
+	template   *template.Template
+	match      Match
+}
+
+type Engine struct {
+	rules  []compiledRule
+	maxAge time.Duration
+	client *resty.Client
+}
+
+var current atomic.Pointer[Engine]
+
+// throttle state survives config reloads, keyed by rule name.
+var (
+	throttleMu sync.Mutex
+	lastSent   = map[string]time.Time{}
+	suppressed = map[string]int{}
+)
+
+var funcs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// delivery is an alert waiting in the outbox.
+type delivery struct {
+	engine *Engine
+	rule   compiledRule
+	alert  Alert
+}
+
+// Alerts are posted by a single goroutine from a bounded outbox, so a slow
+// webhook cannot pile up goroutines. Alerts that do not fit are dropped.
+var (
+	outboxMu   sync.RWMutex
+	outbox     chan delivery
+	outboxDone chan struct{}
+)
+
+// Load compiles the alerting section of the current config and swaps it in.
+// On error the previously loaded rules stay active. The first successful
+// load starts the sender, which Close stops.
+func Load() error {
+	var cfg Config
+	if err := viper.UnmarshalKey("alerting", &cfg); err != nil {
+		return fmt.Errorf("decode alerting config: %w", err)
+	}
+
+	engine, err := Compile(cfg)
+	if err != nil {
+		return err
+	}
+	current.Store(engine)
+	startSender(cfg.QueueSize)
+	return nil
+}
+
+func startSender(size int) {
+	if size <= 0 {
+		size = 100
+	}
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	if outbox != nil {
+		return
+	}
+	outbox = make(chan delivery, size)
+	outboxDone = make(chan struct{})
+	go deliverLoop(outbox, outboxDone)
+}
+
+func deliverLoop(deliveries <-chan delivery, done chan<- struct{}) {
+	defer close(done)
+	for d := range deliveries {
+		if err := d.engine.send(context.Background(), d.rule, d.alert); err != nil {
+			logger.Log.Errorf("Alert %s failed: %v", d.rule.name, err)
+		}
+	}
+}
+
+// enqueue hands an alert to the sender without blocking the ingest worker.
+func enqueue(d delivery) {
+	outboxMu.RLock()
+	defer outboxMu.RUnlock()
+	if outbox != nil {
+		select {
+		case outbox <- d:
+			return
+		default:
+		}
+	}
+	metrics.AlertsDropped.WithLabelValues(d.rule.name).Inc()
+	logger.Log.Warnf("Alert queue full, dropping alert %s", d.rule.name)
+}
+
+// Close stops accepting alerts and waits until the queued ones have been
+// posted or ctx is done.
+func Close(ctx context.Context) error {
+	outboxMu.Lock()
+	deliveries, done := outbox, outboxDone
+	outbox = nil
+	outboxMu.Unlock()
+	if deliveries == nil {
+		return nil
+	}
+
+	close(deliveries)
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d alerts not sent: %w", len(deliveries), ctx.Err())
+	}
+}
+
+func Compile(cfg Config) (*Engine, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = time.Hour
+	}
+	engine := &Engine{maxAge: cfg.MaxAge, client: resty.New().SetTimeout(cfg.Timeout)}
+
+	for i, rule := range cfg.Rules {
+		name := rule.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		compiled, err := compileRule(name, rule, cfg.WebhookURL)
+		if err != nil {
+			return nil, fmt.Errorf("alerting rule %s: %w", name, err)
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+	return engine, nil
+}
+
+func compileRule(name string, rule Rule, defaultURL string) (compiledRule, error) {
+	c := compiledRule{
+		name:       name,
+		webhookURL: rule.WebhookURL,
+		throttle:   rule.Throttle,
+		match:      rule.Match,
+	}
+	if c.webhookURL == "" {
+		c.webhookURL = defaultURL
+	}
+	if c.webhookURL == "" {
+		return c, fmt.Errorf("no webhook_url")
+	}
+
+	for _, patterns := range [][]string{
+		rule.Match.ActivityCodes, rule.Match.Categories, rule.Match.Severities,
+		rule.Match.Messages, rule.Match.TargetTypes, rule.Match.Initiators,
+	} {
+		for _, p := range patterns {
+			if _, err := path.Match(strings.ToLower(p), ""); err != nil {
+				return c, fmt.Errorf("invalid pattern %q: %w", p, err)
+			}
+		}
+	}
+
+	text := rule.Template
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return c, fmt.Errorf("template: %w", err)
+	}
+	c.template = tmpl
+
+	// Render a sample so template errors show up when the config is loaded.
+	if _, err := c.render(sampleAlert(name)); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func (r compiledRule) render(alert Alert) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := r.template.Execute(&buf, alert); err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("template does not render valid JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+func (r compiledRule) matches(ev apicontracts.SplunkAuditEvent) bool {
+	m := r.match
+	if !anyGlob(m.ActivityCodes, ev.ActivityCode) ||
+		!anyGlob(m.Categories, ev.ActivityCategory) ||
+		!anyGlob(m.Severities, ev.ActivitySeverity) ||
+		!anyGlob(m.Messages, ev.Message) ||
+		!anyGlob(m.TargetTypes, ev.TargetType) ||
+		!anyGlob(m.Initiators, ev.InitiatorID) {
+		return false
+	}
+	for key, pattern := range m.Meta {
+		v, ok := ev.Extra[key]
+		if !ok || !anyGlob([]string{pattern}, fmt.Sprint(v)) {
+			return false
+		}
+	}
+	return true
+}
+
+func anyGlob(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	value = strings.ToLower(value)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate queues an alert for every rule matching the audit event. Delivery
+// happens in the background so the ingest workers are not held up.
+func Evaluate(ev apicontracts.SplunkAuditEvent, ts time.Time) {
+	engine := current.Load()
+	if engine == nil || time.Since(ts) > engine.maxAge {
+		return
+	}
+
+	for _, rule := range engine.rules {
+		if !rule.matches(ev) {
+			continue
+		}
+		count, ok := allow(rule)
+		if !ok {
+			logger.Log.Infof("Alert %s throttled", rule.name)
+			continue
+		}
+
+		alert := newAlert(rule.name, ev, ts)
+		alert.Suppressed = count
+		if count > 0 {
+			alert.SuppressedNote = fmt.Sprintf(" (+%d throttled)", count)
+		}
+		enqueue(delivery{engine: engine, rule: rule, alert: alert})
+	}
+}
+
+// allow applies the rule's throttle. It returns the number of alerts
+// suppressed since the last one sent.
+func allow(rule compiledRule) (int, bool) {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+
+	now := time.Now()
+	if last, ok := lastSent[rule.name]; ok && rule.throttle > 0 && now.Sub(last) < rule.throttle {
+		suppressed[rule.name]++
+		return 0, false
+	}
+	count := suppressed[rule.name]
+	lastSent[rule.name] = now
+	delete(suppressed, rule.name)
+	return count, true
+}
+
+// Test renders and sends a sample alert for the named rule, ignoring the
+// match conditions and throttle.
+func Test(ctx context.Context, ruleName string) error {
+	engine := current.Load()
+	if engine == nil {
+		return fmt.Errorf("alerting not loaded")
+	}
+	for _, rule := range engine.rules {
+		if rule.name == ruleName {
+			return engine.send(ctx, rule, sampleAlert(rule.name))
+		}
+	}
+	return fmt.Errorf("no alerting rule %q", ruleName)
+}
+
+// Rules returns the names of the loaded rules.
+func Rules() []string {
+	engine := current.Load()
+	if engine == nil {
+		return nil
+	}
+	names := make([]string, 0, len(engine.rules))
+	for _, rule := range engine.rules {
+		names = append(names, rule.name)
+	}
+	return names
+}
+
+func (e *Engine) send(ctx context.Context, rule compiledRule, alert Alert) error {
+	body, err := rule.render(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post(rule.webhookURL)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("error response: %s", resp.Status())
+	}
+	logger.Log.Infof("Alert %s sent", rule.name)
+	return nil
+}
+
+func newAlert(rule string, ev apicontracts.SplunkAuditEvent, ts time.Time) Alert {
+	target := ev.TargetName
+	if target == "" {
+		target = ev.TargetID
+	}
+	return Alert{
+		Rule:       rule,
+		Time:       ts,
+		Message:    ev.Message,
+		Code:       ev.ActivityCode,
+		Category:   ev.ActivityCategory,
+		Action:     ev.ActivityAction,
+		Severity:   ev.ActivitySeverity,
+		Initiator:  ev.InitiatorID,
+		TargetID:   ev.TargetID,
+		TargetType: ev.TargetType,
+		Target:     target,
+		Meta:       ev.Extra,
+	}
+}
+
+func sampleAlert(rule string) Alert {
+	return newAlert(rule, apicontracts.SplunkAuditEvent{
+		Message:          "User role updated",
+		InitiatorID:      "Test User",
+		TargetID:         "test-target-id",
+		TargetType:       "user",
+		TargetName:       "Test Target",
+		ActivityCode:     "user.role.update",
+		ActivityCategory: "user_management",
+		ActivityAction:   "update",
+		ActivitySeverity: "high",
+		Extra:            map[string]any{"role": "admin"},
+	}, time.Now().UTC())
+}
@@ -0,0 +1,232 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/metrics"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// webhook records alert bodies. While hold is open, requests block until it
+// is closed.
+type webhook struct {
+	*httptest.Server
+	hold chan struct{}
+
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newWebhook(t *testing.T) *webhook {
+	w := &webhook{hold: make(chan struct{})}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.mu.Lock()
+		w.bodies = append(w.bodies, string(b))
+		w.mu.Unlock()
+		<-w.hold
+	}))
+	t.Cleanup(w.Close)
+	return w
+}
+
+func (w *webhook) received() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.bodies)
+}
+
+func load(t *testing.T, cfg Config) {
+	t.Helper()
+	engine, err := Compile(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Store(engine)
+	t.Cleanup(func() { current.Store(nil) })
+}
+
+func adminChange() apicontracts.SplunkAuditEvent {
+	return apicontracts.SplunkAuditEvent{
+		Message:          "User role updated",
+		InitiatorID:      "alice@example.com",
+		TargetName:       "bob@example.com",
+		TargetType:       "user",
+		ActivityCode:     "user.role.update",
+		ActivityCategory: "user_management",
+		ActivitySeverity: "high",
+		Extra:            map[string]any{"role": "admin"},
+	}
+}
+
+func TestEvaluateQueuesAndDropsWhenFull(t *testing.T) {
+	hook := newWebhook(t)
+	load(t, Config{WebhookURL: hook.URL, Rules: []Rule{{Name: "queue-full"}}})
+	startSender(2)
+	t.Cleanup(func() { Close(context.Background()) })
+
+	dropped := func() float64 { return testutil.ToFloat64(metrics.AlertsDropped.WithLabelValues("queue-full")) }
+	before := dropped()
+
+	Evaluate(adminChange(), time.Now())
+	deadline := time.Now().Add(5 * time.Second)
+	for hook.received() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("first alert never posted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// One alert is in flight, two fit in the outbox and the rest are dropped.
+	for range 5 {
+		Evaluate(adminChange(), time.Now())
+	}
+	if got := dropped() - before; got != 3 {
+		t.Errorf("dropped %v alerts, want 3", got)
+	}
+
+	close(hook.hold)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := hook.received(); n != 3 {
+		t.Errorf("webhook received %d alerts, want 3", n)
+	}
+
+	// After Close nothing is queued any more.
+	Evaluate(adminChange(), time.Now())
+	if got := dropped() - before; got != 4 {
+		t.Errorf("dropped %v alerts after close, want 4", got)
+	}
+}
+
+func TestCloseGivesUpAfterContext(t *testing.T) {
+	hook := newWebhook(t)
+	defer close(hook.hold)
+	load(t, Config{WebhookURL: hook.URL, Rules: []Rule{{Name: "slow"}}})
+	startSender(10)
+
+	for range 3 {
+		Evaluate(adminChange(), time.Now())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Close(ctx); err == nil {
+		t.Fatal("Close returned before the alerts were sent")
+	}
+}
+
+func TestEvaluateSkipsOldEvents(t *testing.T) {
+	hook := newWebhook(t)
+	close(hook.hold)
+	load(t, Config{WebhookURL: hook.URL, MaxAge: time.Minute, Rules: []Rule{{Name: "old"}}})
+	startSender(10)
+
+	Evaluate(adminChange(), time.Now().Add(-time.Hour))
+	if err := Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := hook.received(); n != 0 {
+		t.Errorf("webhook received %d alerts for an old event", n)
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		match Match
+		want  bool
+	}{
+		{"empty matches anything", Match{}, true},
+		{"glob on code", Match{ActivityCodes: []string{"user.role.*"}}, true},
+		{"case insensitive", Match{Severities: []string{"HIGH"}}, true},
+		{"values are OR'ed", Match{Categories: []string{"dns", "user_*"}}, true},
+		{"conditions are AND'ed", Match{ActivityCodes: []string{"user.*"}, TargetTypes: []string{"group"}}, false},
+		{"meta", Match{Meta: map[string]string{"role": "adm*"}}, true},
+		{"missing meta key", Match{Meta: map[string]string{"group": "*"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := compiledRule{match: tt.match}
+			if got := rule.matches(adminChange()); got != tt.want {
+				t.Errorf("matches = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThrottleReportsSuppressed(t *testing.T) {
+	rule := compiledRule{name: "throttled", throttle: time.Hour}
+	throttleMu.Lock()
+	delete(lastSent, rule.name)
+	delete(suppressed, rule.name)
+	throttleMu.Unlock()
+
+	if _, ok := allow(rule); !ok {
+		t.Fatal("first alert throttled")
+	}
+	for range 2 {
+		if _, ok := allow(rule); ok {
+			t.Fatal("alert within throttle allowed")
+		}
+	}
+
+	throttleMu.Lock()
+	lastSent[rule.name] = time.Now().Add(-2 * time.Hour)
+	throttleMu.Unlock()
+	if count, ok := allow(rule); !ok || count != 2 {
+		t.Errorf("allow = %d, %t; want 2 suppressed, allowed", count, ok)
+	}
+}
+
+func TestCompileRejectsBadRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr string
+	}{
+		{"no webhook", Rule{Name: "a"}, "no webhook_url"},
+		{"bad pattern", Rule{Name: "b", WebhookURL: "http://x", Match: Match{Messages: []string{"["}}}, "invalid pattern"},
+		{"template not json", Rule{Name: "c", WebhookURL: "http://x", Template: "{{ .Rule }}"}, "valid JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(Config{Rules: []Rule{tt.rule}})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	rule, err := compileRule("admins", Rule{}, "http://x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alert := newAlert("admins", adminChange(), time.Now())
+	alert.SuppressedNote = " (+2 throttled)"
+	body, err := rule.render(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload struct{ Text string }
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	want := "[high] admins: User role updated by alice@example.com (user bob@example.com) (+2 throttled)"
+	if payload.Text != want {
+		t.Errorf("text = %q, want %q", payload.Text, want)
+	}
+}
@@ -0,0 +1,249 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/poller"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/services"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+type Options struct {
+	From time.Time
+	// To defaults to now. A resumed run reuses the end of the interrupted
+	// one.
+	To         time.Time
+	Kind       string // traffic, audit or all
+	Checkpoint string
+	PageSize   int
+	DryRun     bool
+}
+
+// checkpoint records how far a backfill got, so an interrupted run can be
+// resumed with the same arguments.
+type checkpoint struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Kind        string    `json:"kind"`
+	AuditLastID int64     `json:"audit_last_id"`
+	AuditDone   bool      `json:"audit_done"`
+	TrafficPage int       `json:"traffic_page"`
+	TrafficDone bool      `json:"traffic_done"`
+}
+
+type progress struct {
+	sent     int
+	filtered int
+	failed   int
+}
+
+// The pipeline entry points, replaced in tests.
+var (
+	processTraffic = services.ProcessTrafficEvent
+	processAudit   = services.ProcessAuditEvent
+)
+
+// Run re-ingests NetBird events between From and To through the normal
+// enrichment and sink pipeline.
+func Run(ctx context.Context, client *netbirdapi.Client, opts Options) error {
+	switch opts.Kind {
+	case "traffic", "audit", "all":
+	default:
+		return fmt.Errorf("unknown kind %q, want traffic, audit or all", opts.Kind)
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 500
+	}
+
+	cp, err := loadCheckpoint(opts)
+	if err != nil {
+		return err
+	}
+	opts.To = cp.To
+	if !opts.To.After(opts.From) {
+		return fmt.Errorf("--to must be after --from")
+	}
+
+	if opts.Kind != "traffic" && !cp.AuditDone {
+		if err := backfillAudit(ctx, client, opts, cp); err != nil {
+			return err
+		}
+	}
+	if opts.Kind != "audit" && !cp.TrafficDone {
+		if err := backfillTraffic(ctx, client, opts, cp); err != nil {
+			return err
+		}
+	}
+
+	logger.Log.Infof("Backfill %s %s..%s complete", opts.Kind, opts.From.Format(time.RFC3339), opts.To.Format(time.RFC3339))
+	return nil
+}
+
+func backfillAudit(ctx context.Context, client *netbirdapi.Client, opts Options, cp *checkpoint) error {
+	events, err := client.ListAuditEvents(ctx)
+	if err != nil {
+		return fmt.Errorf("fetch audit events: %w", err)
+	}
+
+	var inRange []netbird.NetbirdAuditEvent
+	for _, ev := range events {
+		if !ev.Timestamp.Before(opts.From) && ev.Timestamp.Before(opts.To) {
+			inRange = append(inRange, ev)
+		}
+	}
+	sort.Slice(inRange, func(i, j int) bool { return seq(inRange[i]) < seq(inRange[j]) })
+
+	// The checkpoint stops before the first event that failed, so a rerun
+	// retries it. Events after it are still sent and will be sent again.
+	var p progress
+	for i, ev := range inRange {
+		if seq(ev) <= cp.AuditLastID {
+			continue
+		}
+		envelope, err := poller.AuditEnvelope(ev)
+		if err != nil {
+			// Can never succeed, so it does not hold the checkpoint back.
+			logger.Log.Warnf("Skipping audit event %s: %v", ev.ID, err)
+			p.filtered++
+		} else if _, err := processAudit(ctx, envelope); errors.Is(err, services.ErrFiltered) {
+			p.filtered++
+		} else if err != nil {
+			logger.Log.Warnf("Audit event %s failed: %v", ev.ID, err)
+			p.failed++
+		} else {
+			p.sent++
+		}
+
+		if p.failed == 0 {
+			cp.AuditLastID = seq(ev)
+		}
+		if (i+1)%100 == 0 {
+			logger.Log.Infof("Audit backfill: %d/%d events (%d failed)", i+1, len(inRange), p.failed)
+			if err := saveCheckpoint(opts, cp); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.failed > 0 {
+		if err := saveCheckpoint(opts, cp); err != nil {
+			return err
+		}
+		return fmt.Errorf("%d audit events failed, rerun to retry the audit events after ID %d", p.failed, cp.AuditLastID)
+	}
+	cp.AuditDone = true
+	logger.Log.Infof("Audit backfill done: %d sent, %d skipped", p.sent, p.filtered)
+	return saveCheckpoint(opts, cp)
+}
+
+func backfillTraffic(ctx context.Context, client *netbirdapi.Client, opts Options, cp *checkpoint) error {
+	// The checkpoint only moves past pages whose events were all handed off,
+	// and never past the first page with a failure.
+	var p progress
+	err := client.ListTrafficEvents(ctx, opts.From, opts.To, opts.PageSize, cp.TrafficPage+1, func(page netbird.NetbirdTrafficPage) error {
+		failedBefore := p.failed
+		for _, flow := range page.Data {
+			for _, ev := range poller.TrafficEvents(flow) {
+				_, err := processTraffic(ctx, ev)
+				switch {
+				case err == nil:
+					p.sent++
+				case errors.Is(err, services.ErrFiltered):
+					p.filtered++
+				default:
+					logger.Log.Warnf("Traffic event %s failed: %v", ev.ID, err)
+					p.failed++
+				}
+			}
+		}
+
+		if len(page.Data) == 0 {
+			return nil
+		}
+		logger.Log.Infof("Traffic backfill: page %d/%d (%d sent, %d filtered, %d failed)", page.Page, page.TotalPages, p.sent, p.filtered, p.failed)
+		if failedBefore > 0 || p.failed > failedBefore {
+			return nil
+		}
+		cp.TrafficPage = page.Page
+		return saveCheckpoint(opts, cp)
+	})
+	if err != nil {
+		return fmt.Errorf("fetch traffic events: %w", err)
+	}
+
+	if p.failed > 0 {
+		return fmt.Errorf("%d traffic events failed, rerun to retry from page %d", p.failed, cp.TrafficPage+1)
+	}
+	cp.TrafficDone = true
+	return saveCheckpoint(opts, cp)
+}
+
+func seq(ev netbird.NetbirdAuditEvent) int64 {
+	n, _ := strconv.ParseInt(ev.ID, 10, 64)
+	return n
+}
+
+// loadCheckpoint resumes from the checkpoint file when it was written for the
+// same range and kind, and starts over otherwise. Without To, any checkpoint
+// with the same start and kind is resumed up to its end.
+func loadCheckpoint(opts Options) (*checkpoint, error) {
+	fresh := &checkpoint{From: opts.From, To: opts.To, Kind: opts.Kind}
+	if fresh.To.IsZero() {
+		fresh.To = time.Now().UTC()
+	}
+	if opts.Checkpoint == "" || opts.DryRun {
+		return fresh, nil
+	}
+
+	b, err := os.ReadFile(opts.Checkpoint)
+	if os.IsNotExist(err) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("decode checkpoint %s: %w", opts.Checkpoint, err)
+	}
+	if !cp.From.Equal(opts.From) || cp.Kind != opts.Kind || (!opts.To.IsZero() && !cp.To.Equal(opts.To)) {
+		logger.Log.Warnf("Checkpoint %s is for a different range or kind, starting over", opts.Checkpoint)
+		return fresh, nil
+	}
+
+	logger.Log.Infof("Resuming backfill up to %s from checkpoint %s", cp.To.Format(time.RFC3339), opts.Checkpoint)
+	return &cp, nil
+}
+
+func saveCheckpoint(opts Options, cp *checkpoint) error {
+	if opts.Checkpoint == "" || opts.DryRun {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.Checkpoint), 0o750); err != nil {
+		return fmt.Errorf("create checkpoint dir: %w", err)
+	}
+	tmp := opts.Checkpoint + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o640); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, opts.Checkpoint); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/services"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+var (
+	from = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to   = from.Add(time.Hour)
+)
+
+// fakeAPI serves one traffic flow per page and the given audit events.
+func fakeAPI(t *testing.T, pages int, audit []netbird.NetbirdAuditEvent) *netbirdapi.Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/events/audit", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(audit)
+	})
+	mux.HandleFunc("/api/events/network-traffic", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		result := netbird.NetbirdTrafficPage{TotalPages: pages}
+		if page <= pages {
+			result.Data = []netbird.NetbirdTrafficFlow{{
+				FlowID: "flow-" + strconv.Itoa(page),
+				Events: []netbird.NetbirdTrafficFlowStep{{ID: "page-" + strconv.Itoa(page), Type: "TYPE_START", Timestamp: from}},
+			}}
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	client, err := netbirdapi.NewClient("token", netbirdapi.Config{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+var errSinkDown = errors.New("sink down")
+
+// stubPipeline records what was handed off and returns the listed errors.
+func stubPipeline(t *testing.T, fail map[string]error) *[]string {
+	t.Helper()
+	var handled []string
+	prevTraffic, prevAudit := processTraffic, processAudit
+	processTraffic = func(_ context.Context, ev apicontracts.TrafficEvent) (any, error) {
+		handled = append(handled, ev.ID)
+		return nil, fail[ev.ID]
+	}
+	processAudit = func(_ context.Context, ev apicontracts.AuditEventEnvelope) (any, error) {
+		id := strconv.Itoa(ev.ID)
+		handled = append(handled, id)
+		return nil, fail[id]
+	}
+	t.Cleanup(func() { processTraffic, processAudit = prevTraffic, prevAudit })
+	return &handled
+}
+
+func readCheckpoint(t *testing.T, path string) checkpoint {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		t.Fatal(err)
+	}
+	return cp
+}
+
+func TestTrafficCheckpointStopsBeforeFailedPage(t *testing.T) {
+	client := fakeAPI(t, 3, nil)
+	opts := Options{From: from, To: to, Kind: "traffic", Checkpoint: filepath.Join(t.TempDir(), "backfill.json")}
+
+	// Filtered events do not hold the checkpoint back.
+	handled := stubPipeline(t, map[string]error{"page-1": services.ErrFiltered, "page-2": errSinkDown})
+	if err := Run(context.Background(), client, opts); err == nil {
+		t.Fatal("Run succeeded although an event failed")
+	}
+	if want := []string{"page-1", "page-2", "page-3"}; !slices.Equal(*handled, want) {
+		t.Fatalf("handled %v, want %v", *handled, want)
+	}
+	if cp := readCheckpoint(t, opts.Checkpoint); cp.TrafficPage != 1 || cp.TrafficDone {
+		t.Fatalf("checkpoint = page %d done %t, want page 1 not done", cp.TrafficPage, cp.TrafficDone)
+	}
+
+	handled = stubPipeline(t, nil)
+	if err := Run(context.Background(), client, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"page-2", "page-3"}; !slices.Equal(*handled, want) {
+		t.Fatalf("resumed run handled %v, want %v", *handled, want)
+	}
+	if cp := readCheckpoint(t, opts.Checkpoint); !cp.TrafficDone {
+		t.Error("traffic not marked done")
+	}
+}
+
+func TestAuditCheckpointStopsBeforeFailedEvent(t *testing.T) {
+	var audit []netbird.NetbirdAuditEvent
+	for id := 1; id <= 4; id++ {
+		audit = append(audit, netbird.NetbirdAuditEvent{ID: strconv.Itoa(id), Timestamp: from.Add(time.Minute), Activity: "User joined"})
+	}
+	// Outside the range.
+	audit = append(audit, netbird.NetbirdAuditEvent{ID: "5", Timestamp: to, Activity: "User joined"})
+	client := fakeAPI(t, 0, audit)
+	opts := Options{From: from, To: to, Kind: "audit", Checkpoint: filepath.Join(t.TempDir(), "backfill.json")}
+
+	handled := stubPipeline(t, map[string]error{"1": services.ErrFiltered, "2": errSinkDown})
+	if err := Run(context.Background(), client, opts); err == nil {
+		t.Fatal("Run succeeded although an event failed")
+	}
+	if want := []string{"1", "2", "3", "4"}; !slices.Equal(*handled, want) {
+		t.Fatalf("handled %v, want %v", *handled, want)
+	}
+	if cp := readCheckpoint(t, opts.Checkpoint); cp.AuditLastID != 1 || cp.AuditDone {
+		t.Fatalf("checkpoint = last id %d done %t, want 1 not done", cp.AuditLastID, cp.AuditDone)
+	}
+
+	handled = stubPipeline(t, nil)
+	if err := Run(context.Background(), client, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2", "3", "4"}; !slices.Equal(*handled, want) {
+		t.Fatalf("resumed run handled %v, want %v", *handled, want)
+	}
+}
+
+func TestResumeWithoutTo(t *testing.T) {
+	client := fakeAPI(t, 3, nil)
+	opts := Options{From: from, Kind: "traffic", Checkpoint: filepath.Join(t.TempDir(), "backfill.json")}
+
+	stubPipeline(t, map[string]error{"page-2": errSinkDown})
+	if err := Run(context.Background(), client, opts); err == nil {
+		t.Fatal("Run succeeded although an event failed")
+	}
+	first := readCheckpoint(t, opts.Checkpoint)
+	if first.To.IsZero() || first.TrafficPage != 1 {
+		t.Fatalf("checkpoint = to %v page %d, want the resolved end and page 1", first.To, first.TrafficPage)
+	}
+
+	// Without --to the rerun keeps the end of the first run instead of
+	// starting over with a new one.
+	handled := stubPipeline(t, nil)
+	if err := Run(context.Background(), client, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"page-2", "page-3"}; !slices.Equal(*handled, want) {
+		t.Fatalf("resumed run handled %v, want %v", *handled, want)
+	}
+	if cp := readCheckpoint(t, opts.Checkpoint); !cp.To.Equal(first.To) || !cp.TrafficDone {
+		t.Errorf("checkpoint = to %v done %t, want to %v done", cp.To, cp.TrafficDone, first.To)
+	}
+
+	// An explicit, different --to starts over.
+	opts.To = first.To.Add(time.Hour)
+	handled = stubPipeline(t, nil)
+	if err := Run(context.Background(), client, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"page-1", "page-2", "page-3"}; !slices.Equal(*handled, want) {
+		t.Errorf("run with new --to handled %v, want %v", *handled, want)
+	}
+}
+
+func TestDryRunWritesNoCheckpoint(t *testing.T) {
+	client := fakeAPI(t, 1, nil)
+	opts := Options{From: from, To: to, Kind: "traffic", Checkpoint: filepath.Join(t.TempDir(), "backfill.json"), DryRun: true}
+	stubPipeline(t, nil)
+
+	if err := Run(context.Background(), client, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(opts.Checkpoint); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote a checkpoint: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package netbird
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/refresh"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/spf13/viper"
+)
+
+type registered interface {
+	Run(ctx context.Context)
+}
+
+// caches lists every cache created through newCache, for RunAll. The caches
+// are created concurrently at startup.
+var (
+	cachesMu sync.Mutex
+	caches   []registered
+)
+
+// newCache builds a cache from a list call and loads it, giving up after
+// cache.startup_timeout. When the API is unreachable it falls back to the
+// last snapshot. The returned cache is usable even when err is set; misses
+// keep retrying the API.
+func newCache[T any](name string, list func(ctx context.Context) ([]T, error), id func(T) string) (*refresh.Cache[T], error) {
+	load := func(ctx context.Context) (map[string]T, error) {
+		items, err := list(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cache := make(map[string]T, len(items))
+		for _, item := range items {
+			cache[id(item)] = item
+		}
+		return cache, nil
+	}
+
+	c := refresh.New(name, load, refreshOptions(name))
+	cachesMu.Lock()
+	caches = append(caches, c)
+	cachesMu.Unlock()
+
+	ctx := context.Background()
+	if timeout := viper.GetDuration("cache.startup_timeout"); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := c.Refresh(ctx); err != nil {
+		if snapErr := c.LoadSnapshot(); snapErr != nil {
+			return c, fmt.Errorf("%w (no usable snapshot: %v)", err, snapErr)
+		}
+		logger.Log.Warnf("NetBird API unreachable, starting with cached %s: %v", name, err)
+	}
+	return c, nil
+}
+
+// getByID wraps Cache.Get with the error messages used by all caches.
+func getByID[T any](c *refresh.Cache[T], kind, id string) (T, error) {
+	item, err := c.Get(context.Background(), id)
+	if errors.Is(err, refresh.ErrNotFound) {
+		return item, fmt.Errorf("%s %q not found", kind, id)
+	}
+	if err != nil {
+		return item, fmt.Errorf("refresh failed: %w", err)
+	}
+	return item, nil
+}
+
+// refreshOptions reads cache.<name>.* and falls back to the shared cache.*
+// settings.
+func refreshOptions(name string) refresh.Options {
+	get := func(key string) string {
+		if viper.IsSet("cache." + name + "." + key) {
+			return "cache." + name + "." + key
+		}
+		return "cache." + key
+	}
+	return refresh.Options{
+		Interval:       viper.GetDuration(get("refresh_interval")),
+		NegativeTTL:    viper.GetDuration(get("negative_ttl")),
+		MinMissRefresh: viper.GetDuration(get("min_miss_refresh")),
+		SnapshotFile:   snapshotFile(name),
+	}
+}
+
+func snapshotFile(name string) string {
+	dir := viper.GetString("cache.snapshot_dir")
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, name+".json")
+}
+
+// RunAll starts the background refresh of every cache.
+func RunAll(ctx context.Context) {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	for _, c := range caches {
+		go c.Run(ctx)
+	}
+}
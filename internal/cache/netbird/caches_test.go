@@ -0,0 +1,58 @@
+package netbird
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestNewCacheStartsEmptyAndStaleWhenAPIIsDown(t *testing.T) {
+	down := true
+	list := func(context.Context) ([]string, error) {
+		if down {
+			return nil, errors.New("connection refused")
+		}
+		return []string{"peer-1"}, nil
+	}
+
+	c, err := newCache("test", list, func(s string) string { return s })
+	if err == nil {
+		t.Fatal("newCache hid the failed load")
+	}
+	if c == nil || c.Len() != 0 || !c.Stale() {
+		t.Fatalf("want an empty, stale cache, got %v", c)
+	}
+
+	down = false
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Peek("peer-1"); !ok || c.Stale() {
+		t.Error("cache not filled by a later refresh")
+	}
+}
+
+func TestNewCacheGivesUpAfterStartupTimeout(t *testing.T) {
+	viper.Set("cache.startup_timeout", 20*time.Millisecond)
+	t.Cleanup(func() { viper.Set("cache.startup_timeout", nil) })
+
+	// An API that never answers must not hold up startup.
+	list := func(ctx context.Context) ([]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	start := time.Now()
+	c, err := newCache("hanging", list, func(s string) string { return s })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("newCache error = %v, want deadline exceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("newCache took %v", d)
+	}
+	if !c.Stale() {
+		t.Error("cache not marked stale")
+	}
+}
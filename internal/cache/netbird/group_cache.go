@@ -0,0 +1,23 @@
+package netbird
+
+import (
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/refresh"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+var GlobalGroupCache *GroupCache
+
+type GroupCache struct {
+	*refresh.Cache[netbird.NetbirdGroup]
+}
+
+func NewGroupCache(client *netbirdapi.Client) error {
+	c, err := newCache("groups", client.ListGroups, func(g netbird.NetbirdGroup) string { return g.ID })
+	GlobalGroupCache = &GroupCache{c}
+	return err
+}
+
+func (gc *GroupCache) GetGroupByID(id string) (netbird.NetbirdGroup, error) {
+	return getByID(gc.Cache, "group", id)
+}
@@ -0,0 +1,23 @@
+package netbird
+
+import (
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/refresh"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+var GlobalNameserverGroupCache *NameserverGroupCache
+
+type NameserverGroupCache struct {
+	*refresh.Cache[netbird.NetbirdNameserverGroup]
+}
+
+func NewNameserverGroupCache(client *netbirdapi.Client) error {
+	c, err := newCache("nameservers", client.ListNameserverGroups, func(n netbird.NetbirdNameserverGroup) string { return n.ID })
+	GlobalNameserverGroupCache = &NameserverGroupCache{c}
+	return err
+}
+
+func (nc *NameserverGroupCache) GetNameserverGroupByID(id string) (netbird.NetbirdNameserverGroup, error) {
+	return getByID(nc.Cache, "nameserver group", id)
+}
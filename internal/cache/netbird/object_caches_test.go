@@ -0,0 +1,126 @@
+package netbird
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+// fakeAPI serves one object of every cached type.
+func fakeAPI(t *testing.T) {
+	t.Helper()
+	reply := func(v any) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(v)
+		}
+	}
+	group := func(name string) netbird.NetbirdGroupMinimum {
+		return netbird.NetbirdGroupMinimum{ID: strings.ToLower(name), Name: name}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/groups", reply([]netbird.NetbirdGroup{{ID: "group-1", Name: "Servers"}}))
+	mux.HandleFunc("/api/policies", reply([]netbird.NetbirdPolicy{{ID: "policy-1", Name: "Developers", Rules: []netbird.NetbirdPolicyRule{
+		{ID: "rule-1", Name: "ssh", Enabled: true, Sources: []netbird.NetbirdGroupMinimum{group("Developers")}, Destinations: []netbird.NetbirdGroupMinimum{group("Servers")}},
+		{ID: "rule-2", Name: "https", Enabled: true, Sources: []netbird.NetbirdGroupMinimum{group("Developers"), group("Ops")}, Destinations: []netbird.NetbirdGroupMinimum{group("Web")}},
+		{ID: "rule-3", Name: "disabled", Sources: []netbird.NetbirdGroupMinimum{group("Everyone")}, Destinations: []netbird.NetbirdGroupMinimum{group("Servers")}},
+	}}}))
+	mux.HandleFunc("/api/routes", reply([]netbird.NetbirdRoute{{ID: "route-1", NetworkID: "office-lan"}}))
+	mux.HandleFunc("/api/networks", reply([]netbird.NetbirdNetwork{{ID: "net-1", Name: "prod"}}))
+	mux.HandleFunc("/api/networks/net-1/resources", reply([]netbird.NetbirdNetworkResource{{ID: "res-1", Name: "postgres"}}))
+	mux.HandleFunc("/api/dns/nameservers", reply([]netbird.NetbirdNameserverGroup{{ID: "ns-1", Name: "Internal DNS"}}))
+	mux.HandleFunc("/api/posture-checks", reply([]netbird.NetbirdPostureCheck{{ID: "pc-1", Name: "Min version"}}))
+	mux.HandleFunc("/api/setup-keys", reply([]netbird.NetbirdSetupKey{{ID: "key-1", Name: "CI runners"}}))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	client, err := netbirdapi.NewClient("token", netbirdapi.Config{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, newCache := range []func(*netbirdapi.Client) error{
+		NewGroupCache, NewPolicyCache, NewRouteCache, NewNetworkCache, NewResourceCache,
+		NewNameserverGroupCache, NewPostureCheckCache, NewSetupKeyCache,
+	} {
+		if err := newCache(client); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestObjectCaches(t *testing.T) {
+	fakeAPI(t)
+
+	tests := []struct {
+		name    string
+		get     func(id string) (string, error)
+		id      string
+		want    string
+		wantErr string
+	}{
+		{"group", func(id string) (string, error) { g, err := GlobalGroupCache.GetGroupByID(id); return g.Name, err }, "group-1", "Servers", ""},
+		{"policy", func(id string) (string, error) { p, err := GlobalPolicyCache.GetPolicyByID(id); return p.Name, err }, "policy-1", "Developers", ""},
+		{"route", func(id string) (string, error) { r, err := GlobalRouteCache.GetRouteByID(id); return r.NetworkID, err }, "route-1", "office-lan", ""},
+		{"network", func(id string) (string, error) { n, err := GlobalNetworkCache.GetNetworkByID(id); return n.Name, err }, "net-1", "prod", ""},
+		{"network resource", func(id string) (string, error) {
+			r, err := GlobalResourceCache.GetResourceByID(id)
+			return r.Name + " in " + r.NetworkName, err
+		}, "res-1", "postgres in prod", ""},
+		{"nameserver group", func(id string) (string, error) {
+			n, err := GlobalNameserverGroupCache.GetNameserverGroupByID(id)
+			return n.Name, err
+		}, "ns-1", "Internal DNS", ""},
+		{"posture check", func(id string) (string, error) {
+			c, err := GlobalPostureCheckCache.GetPostureCheckByID(id)
+			return c.Name, err
+		}, "pc-1", "Min version", ""},
+		{"setup key", func(id string) (string, error) { k, err := GlobalSetupKeyCache.GetSetupKeyByID(id); return k.Name, err }, "key-1", "CI runners", ""},
+		{"missing group", func(id string) (string, error) { g, err := GlobalGroupCache.GetGroupByID(id); return g.Name, err }, "group-9", "", `group "group-9" not found`},
+		{"missing route", func(id string) (string, error) { r, err := GlobalRouteCache.GetRouteByID(id); return r.NetworkID, err }, "route-9", "", `route "route-9" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.get(tt.id)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyRulesAndGroups(t *testing.T) {
+	fakeAPI(t)
+
+	policy, rule, ok := GlobalPolicyCache.GetRuleByID("rule-2")
+	if !ok || policy.ID != "policy-1" || rule.Name != "https" {
+		t.Errorf("GetRuleByID(rule-2) = %s, %s, %t", policy.ID, rule.Name, ok)
+	}
+	if _, _, ok := GlobalPolicyCache.GetRuleByID("rule-9"); ok {
+		t.Error("unknown rule found")
+	}
+
+	// Groups of enabled rules only, each listed once.
+	sources, destinations := GlobalPolicyCache.PolicyGroups("policy-1")
+	if want := []string{"Developers", "Ops"}; !slices.Equal(sources, want) {
+		t.Errorf("sources = %v, want %v", sources, want)
+	}
+	if want := []string{"Servers", "Web"}; !slices.Equal(destinations, want) {
+		t.Errorf("destinations = %v, want %v", destinations, want)
+	}
+	if sources, destinations := GlobalPolicyCache.PolicyGroups("policy-9"); sources != nil || destinations != nil {
+		t.Errorf("unknown policy has groups %v %v", sources, destinations)
+	}
+}
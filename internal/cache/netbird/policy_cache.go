@@ -0,0 +1,65 @@
+package netbird
+
+import (
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/refresh"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+var GlobalPolicyCache *PolicyCache
+
+type PolicyCache struct {
+	*refresh.Cache[netbird.NetbirdPolicy]
+}
+
+func NewPolicyCache(client *netbirdapi.Client) error {
+	c, err := newCache("policies", client.ListPolicies, func(p netbird.NetbirdPolicy) string { return p.ID })
+	GlobalPolicyCache = &PolicyCache{c}
+	return err
+}
+
+func (pc *PolicyCache) GetPolicyByID(id string) (netbird.NetbirdPolicy, error) {
+	return getByID(pc.Cache, "policy", id)
+}
+
+// GetRuleByID finds a policy rule and the policy it belongs to. Rules are
+// not indexed, so this scans the cached policies.
+func (pc *PolicyCache) GetRuleByID(id string) (netbird.NetbirdPolicy, netbird.NetbirdPolicyRule, bool) {
+	for _, policy := range pc.All() {
+		for _, rule := range policy.Rules {
+			if rule.ID == id {
+				return policy, rule, true
+			}
+		}
+	}
+	return netbird.NetbirdPolicy{}, netbird.NetbirdPolicyRule{}, false
+}
+
+// PolicyGroups returns the distinct source and destination group names of
+// the enabled rules in a policy.
+func (pc *PolicyCache) PolicyGroups(id string) (sources, destinations []string) {
+	policy, err := pc.GetPolicyByID(id)
+	if err != nil {
+		return nil, nil
+	}
+	seenSrc := map[string]bool{}
+	seenDst := map[string]bool{}
+	for _, rule := range policy.Rules {
+		if !rule.Enabled {
+			continue
+		}
+		for _, g := range rule.Sources {
+			if !seenSrc[g.Name] {
+				seenSrc[g.Name] = true
+				sources = append(sources, g.Name)
+			}
+		}
+		for _, g := range rule.Destinations {
+			if !seenDst[g.Name] {
+				seenDst[g.Name] = true
+				destinations = append(destinations, g.Name)
+			}
+		}
+	}
+	return sources, destinations
+}
@@ -0,0 +1,23 @@
+package netbird
+
+import (
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/refresh"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+var GlobalPostureCheckCache *PostureCheckCache
+
+type PostureCheckCache struct {
+	*refresh.Cache[netbird.NetbirdPostureCheck]
+}
+
+func NewPostureCheckCache(client *netbirdapi.Client) error {
+	c, err := newCache("posture_checks", client.ListPostureChecks, func(p netbird.NetbirdPostureCheck) string { return p.ID })
+	GlobalPostureCheckCache = &PostureCheckCache{c}
+	return err
+}
+
+func (pc *PostureCheckCache) GetPostureCheckByID(id string) (netbird.NetbirdPostureCheck, error) {
+	return getByID(pc.Cache, "posture check", id)
+}
@@ -0,0 +1,42 @@
+package netbird
+
+import (
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/refresh"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+var (
+	GlobalNetworkCache  *NetworkCache
+	GlobalResourceCache *ResourceCache
+)
+
+type NetworkCache struct {
+	*refresh.Cache[netbird.NetbirdNetwork]
+}
+
+// ResourceCache holds the resources of all NetBird networks, keyed by
+// resource ID.
+type ResourceCache struct {
+	*refresh.Cache[netbird.NetbirdNetworkResource]
+}
+
+func NewNetworkCache(client *netbirdapi.Client) error {
+	c, err := newCache("networks", client.ListNetworks, func(n netbird.NetbirdNetwork) string { return n.ID })
+	GlobalNetworkCache = &NetworkCache{c}
+	return err
+}
+
+func NewResourceCache(client *netbirdapi.Client) error {
+	c, err := newCache("resources", client.ListAllNetworkResources, func(r netbird.NetbirdNetworkResource) string { return r.ID })
+	GlobalResourceCache = &ResourceCache{c}
+	return err
+}
+
+func (nc *NetworkCache) GetNetworkByID(id string) (netbird.NetbirdNetwork, error) {
+	return getByID(nc.Cache, "network", id)
+}
+
+func (rc *ResourceCache) GetResourceByID(id string) (netbird.NetbirdNetworkResource, error) {
+	return getByID(rc.Cache, "resource", id)
+}
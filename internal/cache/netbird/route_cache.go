@@ -0,0 +1,23 @@
+package netbird
+
+import (
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/refresh"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+var GlobalRouteCache *RouteCache
+
+type RouteCache struct {
+	*refresh.Cache[netbird.NetbirdRoute]
+}
+
+func NewRouteCache(client *netbirdapi.Client) error {
+	c, err := newCache("routes", client.ListRoutes, func(r netbird.NetbirdRoute) string { return r.ID })
+	GlobalRouteCache = &RouteCache{c}
+	return err
+}
+
+func (rc *RouteCache) GetRouteByID(id string) (netbird.NetbirdRoute, error) {
+	return getByID(rc.Cache, "route", id)
+}
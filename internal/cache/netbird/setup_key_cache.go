@@ -0,0 +1,23 @@
+package netbird
+
+import (
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/refresh"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+var GlobalSetupKeyCache *SetupKeyCache
+
+type SetupKeyCache struct {
+	*refresh.Cache[netbird.NetbirdSetupKey]
+}
+
+func NewSetupKeyCache(client *netbirdapi.Client) error {
+	c, err := newCache("setup_keys", client.ListSetupKeys, func(k netbird.NetbirdSetupKey) string { return k.ID })
+	GlobalSetupKeyCache = &SetupKeyCache{c}
+	return err
+}
+
+func (sc *SetupKeyCache) GetSetupKeyByID(id string) (netbird.NetbirdSetupKey, error) {
+	return getByID(sc.Cache, "setup key", id)
+}
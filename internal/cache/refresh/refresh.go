@@ -0,0 +1,298 @@
+package refresh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type Options struct {
+	// Interval between scheduled background refreshes. Zero disables them.
+	Interval time.Duration
+	// NegativeTTL is how long an ID that was missing after a refresh is
+	// reported as not found without asking the API again.
+	NegativeTTL time.Duration
+	// MinMissRefresh is the minimum time between refreshes triggered by
+	// cache misses.
+	MinMissRefresh time.Duration
+	// SnapshotFile is written after every successful refresh and can be
+	// loaded at startup when the API is unreachable. Empty disables it.
+	SnapshotFile string
+}
+
+type snapshot[T any] struct {
+	SavedAt time.Time    `json:"saved_at"`
+	Items   map[string]T `json:"items"`
+}
+
+// LoadFunc fetches the complete set of items keyed by ID.
+type LoadFunc[T any] func(ctx context.Context) (map[string]T, error)
+
+// Cache holds a full copy of a NetBird collection. Misses trigger at most one
+// concurrent reload, and no more than one per MinMissRefresh.
+type Cache[T any] struct {
+	name string
+	load LoadFunc[T]
+	opts Options
+
+	group singleflight.Group
+
+	mu              sync.RWMutex
+	items           map[string]T
+	negative        map[string]time.Time
+	loadedAt        time.Time
+	lastMissRefresh time.Time
+	refreshing      bool
+	stale           bool
+}
+
+func New[T any](name string, load LoadFunc[T], opts Options) *Cache[T] {
+	return &Cache[T]{
+		name:     name,
+		load:     load,
+		opts:     opts,
+		items:    make(map[string]T),
+		negative: make(map[string]time.Time),
+	}
+}
+
+// Refresh reloads all items. Concurrent callers share a single API request.
+// A failed refresh keeps the current items, if any, but marks them as stale.
+func (c *Cache[T]) Refresh(ctx context.Context) error {
+	_, err, _ := c.group.Do("refresh", func() (any, error) {
+		c.setRefreshing(true)
+		defer c.setRefreshing(false)
+
+		items, err := c.load(ctx)
+		if err != nil {
+			metrics.CacheRefreshes.WithLabelValues(c.name, "error").Inc()
+			c.mu.Lock()
+			c.stale = true
+			c.mu.Unlock()
+			c.updateGauges()
+			return nil, err
+		}
+		metrics.CacheRefreshes.WithLabelValues(c.name, "ok").Inc()
+
+		now := time.Now()
+		c.mu.Lock()
+		c.items = items
+		c.loadedAt = now
+		c.stale = false
+		// IDs that exist now must not stay negatively cached, and expired
+		// entries are only removed when looked up again, which may be never.
+		for id, until := range c.negative {
+			if _, ok := items[id]; ok || !now.Before(until) {
+				delete(c.negative, id)
+			}
+		}
+		c.mu.Unlock()
+		c.updateGauges()
+
+		if err := c.saveSnapshot(items, now); err != nil {
+			logger.Log.Warnf("Failed to write %s cache snapshot: %v", c.name, err)
+		}
+
+		logger.Log.Infof("Cache %s refreshed (%d entries)", c.name, len(items))
+		return nil, nil
+	})
+	return err
+}
+
+// LoadSnapshot fills the cache from SnapshotFile. The items are served as
+// stale until the next successful refresh.
+func (c *Cache[T]) LoadSnapshot() error {
+	if c.opts.SnapshotFile == "" {
+		return fmt.Errorf("no snapshot file configured")
+	}
+	b, err := os.ReadFile(c.opts.SnapshotFile)
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+	var snap snapshot[T]
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return fmt.Errorf("decode snapshot %s: %w", c.opts.SnapshotFile, err)
+	}
+	if snap.Items == nil {
+		snap.Items = make(map[string]T)
+	}
+
+	c.mu.Lock()
+	c.items = snap.Items
+	c.loadedAt = snap.SavedAt
+	c.stale = true
+	c.mu.Unlock()
+	c.updateGauges()
+
+	logger.Log.Warnf("Cache %s loaded from snapshot %s saved at %s (%d entries), serving stale data",
+		c.name, c.opts.SnapshotFile, snap.SavedAt.Format(time.RFC3339), len(snap.Items))
+	return nil
+}
+
+func (c *Cache[T]) saveSnapshot(items map[string]T, savedAt time.Time) error {
+	if c.opts.SnapshotFile == "" {
+		return nil
+	}
+	b, err := json.Marshal(snapshot[T]{SavedAt: savedAt, Items: items})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.opts.SnapshotFile), 0o750); err != nil {
+		return fmt.Errorf("create snapshot dir: %w", err)
+	}
+	tmp := c.opts.SnapshotFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o640); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	return os.Rename(tmp, c.opts.SnapshotFile)
+}
+
+// Stale reports whether the cache serves data that could not be confirmed by
+// the last refresh attempt.
+func (c *Cache[T]) Stale() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stale
+}
+
+func (c *Cache[T]) updateGauges() {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	metrics.CacheEntries.WithLabelValues(c.name).Set(float64(len(c.items)))
+	stale := 0.0
+	if c.stale {
+		stale = 1
+	}
+	metrics.CacheStale.WithLabelValues(c.name).Set(stale)
+	if !c.loadedAt.IsZero() {
+		metrics.CacheLastRefresh.WithLabelValues(c.name).Set(float64(c.loadedAt.Unix()))
+	}
+}
+
+// Get returns the item with the given ID, refreshing on a miss unless the
+// ID is negatively cached or a miss refresh happened too recently.
+func (c *Cache[T]) Get(ctx context.Context, id string) (T, error) {
+	if item, ok := c.lookup(id); ok {
+		return item, nil
+	}
+
+	var zero T
+	if !c.missRefreshAllowed(id) {
+		return zero, ErrNotFound
+	}
+	if err := c.Refresh(ctx); err != nil {
+		return zero, err
+	}
+
+	if item, ok := c.lookup(id); ok {
+		return item, nil
+	}
+	c.mu.Lock()
+	c.negative[id] = time.Now().Add(c.opts.NegativeTTL)
+	c.mu.Unlock()
+	return zero, ErrNotFound
+}
+
+// Peek returns the cached item without triggering a refresh.
+func (c *Cache[T]) Peek(id string) (T, bool) {
+	return c.lookup(id)
+}
+
+// All returns a snapshot of the cached items.
+func (c *Cache[T]) All() map[string]T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	items := make(map[string]T, len(c.items))
+	for id, item := range c.items {
+		items[id] = item
+	}
+	return items
+}
+
+func (c *Cache[T]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.items)
+}
+
+func (c *Cache[T]) LoadedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.loadedAt
+}
+
+// Run refreshes the cache every Interval until ctx is cancelled. While the
+// cache is stale it retries every MinMissRefresh instead.
+func (c *Cache[T]) Run(ctx context.Context) {
+	if c.opts.Interval <= 0 {
+		return
+	}
+	timer := time.NewTimer(c.nextRefresh())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if err := c.Refresh(ctx); err != nil {
+				logger.Log.Warnf("Cache %s refresh failed: %v", c.name, err)
+			}
+			timer.Reset(c.nextRefresh())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Cache[T]) nextRefresh() time.Duration {
+	if c.Stale() && c.opts.MinMissRefresh > 0 && c.opts.MinMissRefresh < c.opts.Interval {
+		return c.opts.MinMissRefresh
+	}
+	return c.opts.Interval
+}
+
+func (c *Cache[T]) lookup(id string) (T, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	item, ok := c.items[id]
+	return item, ok
+}
+
+func (c *Cache[T]) setRefreshing(v bool) {
+	c.mu.Lock()
+	c.refreshing = v
+	c.mu.Unlock()
+}
+
+// missRefreshAllowed reports whether a miss for id may trigger a refresh.
+// A refresh already in flight is always joined, since it costs nothing extra.
+func (c *Cache[T]) missRefreshAllowed(id string) bool {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until, ok := c.negative[id]; ok {
+		if now.Before(until) {
+			return false
+		}
+		delete(c.negative, id)
+	}
+	if c.refreshing {
+		return true
+	}
+	if now.Sub(c.lastMissRefresh) < c.opts.MinMissRefresh {
+		return false
+	}
+	c.lastMissRefresh = now
+	return true
+}
@@ -0,0 +1,177 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// source is a LoadFunc whose items and failure can be changed by the test.
+type source struct {
+	mu    sync.Mutex
+	items map[string]string
+	err   error
+	loads atomic.Int32
+}
+
+func (s *source) set(items map[string]string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items, s.err = items, err
+}
+
+func (s *source) load(context.Context) (map[string]string, error) {
+	s.loads.Add(1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	items := make(map[string]string, len(s.items))
+	for k, v := range s.items {
+		items[k] = v
+	}
+	return items, nil
+}
+
+func TestGetRefreshesOnMiss(t *testing.T) {
+	src := &source{items: map[string]string{"a": "A"}}
+	c := New("test", src.load, Options{NegativeTTL: time.Hour})
+
+	if v, err := c.Get(context.Background(), "a"); err != nil || v != "A" {
+		t.Fatalf("Get(a) = %q, %v", v, err)
+	}
+	if n := src.loads.Load(); n != 1 {
+		t.Fatalf("loads = %d, want 1", n)
+	}
+
+	// A hit does not reload, a missing ID is negatively cached.
+	c.Get(context.Background(), "a")
+	for range 3 {
+		if _, err := c.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get(missing) error = %v, want ErrNotFound", err)
+		}
+	}
+	if n := src.loads.Load(); n != 2 {
+		t.Fatalf("loads = %d, want 2", n)
+	}
+}
+
+func TestMissRefreshIsRateLimited(t *testing.T) {
+	src := &source{items: map[string]string{}}
+	c := New("test", src.load, Options{MinMissRefresh: time.Hour})
+
+	for _, id := range []string{"x", "y", "z"} {
+		c.Get(context.Background(), id)
+	}
+	if n := src.loads.Load(); n != 1 {
+		t.Fatalf("loads = %d, want 1", n)
+	}
+}
+
+func TestRefreshPrunesNegativeEntries(t *testing.T) {
+	src := &source{items: map[string]string{}}
+	c := New("test", src.load, Options{NegativeTTL: 10 * time.Millisecond})
+
+	for _, id := range []string{"gone", "later"} {
+		c.Get(context.Background(), id)
+	}
+	if len(c.negative) != 2 {
+		t.Fatalf("negative entries = %d, want 2", len(c.negative))
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.negative) != 0 {
+		t.Errorf("expired negative entries kept: %v", c.negative)
+	}
+}
+
+func TestRefreshClearsNegativeEntryWhenItemAppears(t *testing.T) {
+	src := &source{items: map[string]string{}}
+	c := New("test", src.load, Options{NegativeTTL: time.Hour})
+
+	if _, err := c.Get(context.Background(), "new"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get(new) error = %v, want ErrNotFound", err)
+	}
+	src.set(map[string]string{"new": "N"}, nil)
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get(context.Background(), "new"); err != nil || v != "N" {
+		t.Fatalf("Get(new) = %q, %v", v, err)
+	}
+}
+
+func TestFailedRefreshMarksStale(t *testing.T) {
+	src := &source{err: errors.New("api down")}
+	c := New("test", src.load, Options{})
+
+	// An empty cache that cannot be loaded is stale too, so the background
+	// refresh retries it sooner.
+	if err := c.Refresh(context.Background()); err == nil {
+		t.Fatal("Refresh succeeded")
+	}
+	if !c.Stale() {
+		t.Error("empty cache not marked stale")
+	}
+
+	src.set(map[string]string{"a": "A"}, nil)
+	if err := c.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	src.set(nil, errors.New("api down"))
+	if err := c.Refresh(context.Background()); err == nil {
+		t.Fatal("Refresh succeeded")
+	}
+	if !c.Stale() {
+		t.Error("cache not stale after failed refresh")
+	}
+	if v, ok := c.Peek("a"); !ok || v != "A" {
+		t.Errorf("items lost on failed refresh: %q, %t", v, ok)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cache", "test.json")
+	src := &source{items: map[string]string{"a": "A", "b": "B"}}
+	if err := New("test", src.load, Options{SnapshotFile: file}).Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New("test", (&source{err: errors.New("api down")}).load, Options{SnapshotFile: file})
+	if err := c.LoadSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 2 || !c.Stale() {
+		t.Errorf("snapshot loaded %d items, stale %t; want 2 items, stale", c.Len(), c.Stale())
+	}
+}
+
+func TestConcurrentMissesShareRefresh(t *testing.T) {
+	src := &source{items: map[string]string{"a": "A"}}
+	c := New("test", src.load, Options{NegativeTTL: time.Hour, MinMissRefresh: time.Hour})
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				c.Get(context.Background(), "a")
+			} else {
+				c.Get(context.Background(), "missing")
+			}
+		}()
+	}
+	wg.Wait()
+	if n := src.loads.Load(); n > 2 {
+		t.Errorf("loads = %d, want at most 2", n)
+	}
+}
@@ -0,0 +1,259 @@
+package dedup
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/metrics"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netaddr"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/spf13/viper"
+)
+
+const (
+	KeyTuple  = "tuple"
+	KeyFlowID = "flow_id"
+)
+
+// Config is the dedup section of config.yaml.
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Window is how long a connection is remembered, and how long an event
+	// from another reporter is held back waiting for a preferred one.
+	Window time.Duration `mapstructure:"window"`
+	// Key is tuple (protocol and both endpoints, in either direction) or
+	// flow_id.
+	Key string `mapstructure:"key"`
+	// PreferReporters are globs on the reporter hostname or ID, e.g. the exit
+	// nodes. Empty means the first report wins.
+	PreferReporters []string `mapstructure:"prefer_reporters"`
+	// MaxEntries bounds memory. When full, events pass through unchecked.
+	MaxEntries int `mapstructure:"max_entries"`
+}
+
+// ForwardFunc sends a surviving event on.
+type ForwardFunc func(ctx context.Context) error
+
+type entry struct {
+	seen      time.Time
+	forwarded bool
+	held      ForwardFunc
+}
+
+// Deduper drops traffic events for a connection that was already reported by
+// the other end.
+type Deduper struct {
+	cfg Config
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+var GlobalDeduper *Deduper
+
+func New(cfg Config) *Deduper {
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * time.Second
+	}
+	if cfg.Key == "" {
+		cfg.Key = KeyTuple
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 100000
+	}
+	return &Deduper{cfg: cfg, entries: make(map[string]*entry)}
+}
+
+// Init sets GlobalDeduper from the dedup section when it is enabled.
+func Init() error {
+	var cfg Config
+	if err := viper.UnmarshalKey("dedup", &cfg); err != nil {
+		return err
+	}
+	if !cfg.Enabled {
+		GlobalDeduper = nil
+		return nil
+	}
+	for _, p := range cfg.PreferReporters {
+		if _, err := path.Match(strings.ToLower(p), ""); err != nil {
+			return fmt.Errorf("invalid prefer_reporters pattern %q: %w", p, err)
+		}
+	}
+	switch cfg.Key {
+	case "", KeyTuple, KeyFlowID:
+	default:
+		return fmt.Errorf("unknown dedup key %q, want %q or %q", cfg.Key, KeyTuple, KeyFlowID)
+	}
+
+	GlobalDeduper = New(cfg)
+	logger.Log.Infof("Traffic de-duplication enabled (key %s, window %s)", GlobalDeduper.cfg.Key, GlobalDeduper.cfg.Window)
+	return nil
+}
+
+// Key identifies the connection of ev independently of which end reported
+// it. An empty key means the event cannot be de-duplicated.
+func (d *Deduper) Key(ev apicontracts.TrafficEvent) string {
+	if d.cfg.Key == KeyFlowID {
+		if ev.Meta.FlowID == "" {
+			return ""
+		}
+		return strings.ToUpper(ev.Message) + "|" + ev.Meta.FlowID
+	}
+
+	src := endpoint(ev.Meta.SourceAddr)
+	dst := endpoint(ev.Meta.DestinationAddr)
+	if src == "" || dst == "" {
+		return ""
+	}
+	if dst < src {
+		src, dst = dst, src
+	}
+	return strings.ToUpper(ev.Message) + "|" + strconv.Itoa(ev.Meta.Protocol) + "|" + src + "|" + dst
+}
+
+func endpoint(addr string) string {
+	ip, port := netaddr.Split(addr)
+	if !ip.IsValid() {
+		return ""
+	}
+	return ip.WithZone("").String() + "#" + strconv.Itoa(port)
+}
+
+// Preferred reports whether events from the reporter win over the other end.
+func (d *Deduper) Preferred(reporterID, reporterName string) bool {
+	if len(d.cfg.PreferReporters) == 0 {
+		return true
+	}
+	for _, p := range d.cfg.PreferReporters {
+		p = strings.ToLower(p)
+		if ok, _ := path.Match(p, strings.ToLower(reporterName)); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, strings.ToLower(reporterID)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Process forwards ev unless its connection was already reported within the
+// window. Events from a reporter that is not preferred are held back for the
+// window and dropped if the preferred reporter shows up; otherwise Run
+// forwards them when the window expires.
+func (d *Deduper) Process(ctx context.Context, ev apicontracts.TrafficEvent, reporterName string, forward ForwardFunc) error {
+	key := d.Key(ev)
+	if key == "" {
+		metrics.DedupEvents.WithLabelValues("unkeyed").Inc()
+		return forward(ctx)
+	}
+	preferred := d.Preferred(ev.Meta.ReporterID, reporterName)
+	now := time.Now()
+
+	d.mu.Lock()
+	e, ok := d.entries[key]
+	if ok && now.Sub(e.seen) >= d.cfg.Window {
+		// Utløpt, men ikke feid ennå.
+		held := e.held
+		delete(d.entries, key)
+		ok = false
+		if held != nil {
+			defer d.release(held)
+		}
+	}
+
+	switch {
+	case !ok && len(d.entries) >= d.cfg.MaxEntries:
+		d.mu.Unlock()
+		metrics.DedupEvents.WithLabelValues("overflow").Inc()
+		return forward(ctx)
+
+	case !ok && preferred:
+		d.entries[key] = &entry{seen: now, forwarded: true}
+		d.mu.Unlock()
+		metrics.DedupEvents.WithLabelValues("unique").Inc()
+		return forward(ctx)
+
+	case !ok:
+		d.entries[key] = &entry{seen: now, held: forward}
+		d.mu.Unlock()
+		metrics.DedupEvents.WithLabelValues("held").Inc()
+		return nil
+
+	case !e.forwarded && preferred:
+		e.held = nil
+		e.forwarded = true
+		d.mu.Unlock()
+		metrics.DedupEvents.WithLabelValues("replaced").Inc()
+		return forward(ctx)
+	}
+
+	d.mu.Unlock()
+	metrics.DedupEvents.WithLabelValues("duplicate").Inc()
+	return nil
+}
+
+// Sweep forgets connections older than the window and forwards the events
+// that were held back for them.
+func (d *Deduper) Sweep(now time.Time) {
+	var release []ForwardFunc
+	d.mu.Lock()
+	for key, e := range d.entries {
+		if now.Sub(e.seen) < d.cfg.Window {
+			continue
+		}
+		if e.held != nil {
+			release = append(release, e.held)
+		}
+		delete(d.entries, key)
+	}
+	d.mu.Unlock()
+
+	for _, forward := range release {
+		d.release(forward)
+	}
+}
+
+// Run sweeps expired connections until ctx is cancelled.
+func (d *Deduper) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(d.cfg.Window/4, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			d.Sweep(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close forwards every event still held back.
+func (d *Deduper) Close() {
+	var release []ForwardFunc
+	d.mu.Lock()
+	for _, e := range d.entries {
+		if e.held != nil {
+			release = append(release, e.held)
+		}
+	}
+	d.entries = make(map[string]*entry)
+	d.mu.Unlock()
+
+	for _, forward := range release {
+		d.release(forward)
+	}
+}
+
+func (d *Deduper) release(forward ForwardFunc) {
+	metrics.DedupEvents.WithLabelValues("released").Inc()
+	if err := forward(context.Background()); err != nil {
+		logger.Log.Errorf("Failed to forward held traffic event: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package dedup
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+// report is a traffic event for one connection as seen by reporter.
+func report(reporter, src, dst string) apicontracts.TrafficEvent {
+	return apicontracts.TrafficEvent{
+		Message: "TYPE_START",
+		Meta: apicontracts.TrafficMeta{
+			ReporterID:      reporter,
+			SourceAddr:      src,
+			DestinationAddr: dst,
+			Protocol:        6,
+			FlowID:          "flow-" + reporter,
+		},
+	}
+}
+
+// forwards counts the forwarded events per name.
+type forwards struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (f *forwards) fn(name string) ForwardFunc {
+	return func(context.Context) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.counts == nil {
+			f.counts = map[string]int{}
+		}
+		f.counts[name]++
+		return nil
+	}
+}
+
+func (f *forwards) get(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counts[name]
+}
+
+func TestKey(t *testing.T) {
+	tuple := New(Config{})
+	a := report("peer-a", "100.64.0.1:51234", "10.0.0.5:443")
+	b := report("peer-b", "10.0.0.5:443", "100.64.0.1:51234")
+	if ka, kb := tuple.Key(a), tuple.Key(b); ka == "" || ka != kb {
+		t.Errorf("both ends of a connection give keys %q and %q", ka, kb)
+	}
+	zoned := report("peer-c", "[fe80::1%eth0]:51234", "[fe80::2]:443")
+	if k := tuple.Key(zoned); k != tuple.Key(report("peer-d", "[fe80::2]:443", "[fe80::1]:51234")) {
+		t.Errorf("zone not ignored: %q", k)
+	}
+	end := b
+	end.Message = "TYPE_END"
+	if tuple.Key(a) == tuple.Key(end) {
+		t.Error("start and end of a connection share a key")
+	}
+	if k := tuple.Key(report("peer-a", "host.example.com:1", "10.0.0.5:443")); k != "" {
+		t.Errorf("unparsable address gives key %q", k)
+	}
+
+	byFlow := New(Config{Key: KeyFlowID})
+	if byFlow.Key(a) == byFlow.Key(b) {
+		t.Error("different flow IDs share a key")
+	}
+	a.Meta.FlowID = ""
+	if k := byFlow.Key(a); k != "" {
+		t.Errorf("event without flow ID gives key %q", k)
+	}
+}
+
+func TestPreferred(t *testing.T) {
+	d := New(Config{PreferReporters: []string{"Exit-*"}})
+	tests := []struct {
+		id, name string
+		want     bool
+	}{
+		{"peer-1", "exit-oslo", true},
+		{"EXIT-1", "", true},
+		{"peer-1", "laptop", false},
+	}
+	for _, tt := range tests {
+		if got := d.Preferred(tt.id, tt.name); got != tt.want {
+			t.Errorf("Preferred(%q, %q) = %t, want %t", tt.id, tt.name, got, tt.want)
+		}
+	}
+	if !New(Config{}).Preferred("anyone", "") {
+		t.Error("without prefer_reporters every reporter should be preferred")
+	}
+}
+
+func TestFirstReportWins(t *testing.T) {
+	d := New(Config{Window: time.Minute})
+	f := &forwards{}
+	ctx := context.Background()
+
+	d.Process(ctx, report("peer-a", "100.64.0.1:51234", "10.0.0.5:443"), "", f.fn("a"))
+	d.Process(ctx, report("peer-b", "10.0.0.5:443", "100.64.0.1:51234"), "", f.fn("b"))
+	d.Process(ctx, report("peer-a", "100.64.0.1:51235", "10.0.0.5:443"), "", f.fn("other"))
+	if f.get("a") != 1 || f.get("b") != 0 || f.get("other") != 1 {
+		t.Errorf("forwarded %v, want a and other", f.counts)
+	}
+}
+
+func TestHeldEventReplacedByPreferred(t *testing.T) {
+	d := New(Config{Window: time.Minute, PreferReporters: []string{"exit-*"}})
+	f := &forwards{}
+	ctx := context.Background()
+
+	d.Process(ctx, report("peer-a", "100.64.0.1:51234", "10.0.0.5:443"), "laptop", f.fn("laptop"))
+	if f.get("laptop") != 0 {
+		t.Fatal("event from a reporter that is not preferred was forwarded at once")
+	}
+	d.Process(ctx, report("peer-b", "10.0.0.5:443", "100.64.0.1:51234"), "exit-oslo", f.fn("exit"))
+	d.Process(ctx, report("peer-c", "10.0.0.5:443", "100.64.0.1:51234"), "exit-bergen", f.fn("exit2"))
+
+	d.Sweep(time.Now().Add(time.Hour))
+	if f.get("laptop") != 0 || f.get("exit") != 1 || f.get("exit2") != 0 {
+		t.Errorf("forwarded %v, want only the first preferred report", f.counts)
+	}
+}
+
+func TestHeldEventReleased(t *testing.T) {
+	ctx := context.Background()
+	laptop := report("peer-a", "100.64.0.1:51234", "10.0.0.5:443")
+
+	t.Run("by sweep", func(t *testing.T) {
+		d := New(Config{Window: time.Minute, PreferReporters: []string{"exit-*"}})
+		f := &forwards{}
+		d.Process(ctx, laptop, "laptop", f.fn("laptop"))
+		d.Sweep(time.Now())
+		if f.get("laptop") != 0 {
+			t.Fatal("released before the window expired")
+		}
+		d.Sweep(time.Now().Add(time.Minute))
+		if f.get("laptop") != 1 {
+			t.Errorf("forwarded %v, want laptop released", f.counts)
+		}
+	})
+
+	t.Run("by an event after the window", func(t *testing.T) {
+		d := New(Config{Window: 10 * time.Millisecond, PreferReporters: []string{"exit-*"}})
+		f := &forwards{}
+		d.Process(ctx, laptop, "laptop", f.fn("first"))
+		time.Sleep(20 * time.Millisecond)
+		d.Process(ctx, laptop, "laptop", f.fn("second"))
+		if f.get("first") != 1 || f.get("second") != 0 {
+			t.Errorf("forwarded %v, want first released and second held", f.counts)
+		}
+	})
+
+	t.Run("by close", func(t *testing.T) {
+		d := New(Config{Window: time.Minute, PreferReporters: []string{"exit-*"}})
+		f := &forwards{}
+		d.Process(ctx, laptop, "laptop", f.fn("laptop"))
+		d.Close()
+		if f.get("laptop") != 1 {
+			t.Errorf("forwarded %v, want laptop released", f.counts)
+		}
+	})
+}
+
+func TestFullTablePassesThrough(t *testing.T) {
+	d := New(Config{Window: time.Minute, MaxEntries: 1})
+	f := &forwards{}
+	ctx := context.Background()
+
+	d.Process(ctx, report("peer-a", "100.64.0.1:1", "10.0.0.5:443"), "", f.fn("tracked"))
+	for range 2 {
+		d.Process(ctx, report("peer-a", "100.64.0.1:2", "10.0.0.5:443"), "", f.fn("untracked"))
+	}
+	if f.get("tracked") != 1 || f.get("untracked") != 2 {
+		t.Errorf("forwarded %v, want untracked events passed through", f.counts)
+	}
+}
+
+func TestConcurrentProcess(t *testing.T) {
+	d := New(Config{Window: time.Hour, PreferReporters: []string{"exit-*"}})
+	var forwarded atomic.Int32
+	forward := func(context.Context) error {
+		forwarded.Add(1)
+		return nil
+	}
+
+	// Both ends of 200 connections reported from different goroutines.
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				src := "100.64.0.1:" + strconv.Itoa(10000+i)
+				if w%2 == 0 {
+					d.Process(context.Background(), report("peer", src, "10.0.0.5:443"), "laptop", forward)
+				} else {
+					d.Process(context.Background(), report("exit", "10.0.0.5:443", src), "exit-oslo", forward)
+				}
+				if i%50 == 0 {
+					d.Sweep(time.Now())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	d.Close()
+
+	if n := forwarded.Load(); n != 200 {
+		t.Errorf("forwarded %d events, want one per connection (200)", n)
+	}
+}
@@ -0,0 +1,122 @@
+package expr
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netaddr"
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// cidr("10.0.0.0/8").contains(dst_ip)
+
+var cidrType = cel.OpaqueType("net.CIDR")
+
+type cidrVal struct {
+	network netip.Prefix
+}
+
+func (c cidrVal) ConvertToNative(typeDesc reflect.Type) (any, error) {
+	if reflect.TypeOf(c.network).AssignableTo(typeDesc) {
+		return c.network, nil
+	}
+	return nil, fmt.Errorf("unsupported conversion from net.CIDR to %v", typeDesc)
+}
+
+func (c cidrVal) ConvertToType(typeVal ref.Type) ref.Val {
+	switch typeVal {
+	case cidrType:
+		return c
+	case types.StringType:
+		return types.String(c.network.String())
+	case types.TypeType:
+		return cidrType
+	}
+	return types.NewErr("type conversion error from net.CIDR to %s", typeVal)
+}
+
+func (c cidrVal) Equal(other ref.Val) ref.Val {
+	o, ok := other.(cidrVal)
+	if !ok {
+		return types.False
+	}
+	return types.Bool(c.network == o.network)
+}
+
+func (c cidrVal) Type() ref.Type {
+	return cidrType
+}
+
+func (c cidrVal) Value() any {
+	return c.network
+}
+
+// checkCIDRLiterals parses the string literals given to cidr(), so a typo in
+// a network fails when the rules are loaded rather than on every event.
+func checkCIDRLiterals(a *cel.Ast) error {
+	root := celast.NavigateAST(a.NativeRep())
+	for _, call := range celast.MatchDescendants(root, celast.FunctionMatcher("cidr")) {
+		args := call.AsCall().Args()
+		if len(args) != 1 || args[0].Kind() != celast.LiteralKind {
+			continue
+		}
+		s, ok := args[0].AsLiteral().(types.String)
+		if !ok {
+			continue
+		}
+		if _, err := netaddr.ParsePrefix(string(s)); err != nil {
+			return fmt.Errorf("invalid CIDR %q: %w", string(s), err)
+		}
+	}
+	return nil
+}
+
+func cidrLib() cel.EnvOption {
+	return cel.Lib(cidrLibrary{})
+}
+
+type cidrLibrary struct{}
+
+func (cidrLibrary) CompileOptions() []cel.EnvOption {
+	return []cel.EnvOption{
+		cel.Function("cidr",
+			cel.Overload("cidr_string", []*cel.Type{cel.StringType}, cidrType,
+				cel.UnaryBinding(func(v ref.Val) ref.Val {
+					s, ok := v.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(v)
+					}
+					network, err := netaddr.ParsePrefix(string(s))
+					if err != nil {
+						return types.NewErr("invalid CIDR %q: %v", string(s), err)
+					}
+					return cidrVal{network: network}
+				}),
+			),
+		),
+		cel.Function("contains",
+			cel.MemberOverload("cidr_contains_string", []*cel.Type{cidrType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(func(lhs, rhs ref.Val) ref.Val {
+					c, ok := lhs.(cidrVal)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(lhs)
+					}
+					s, ok := rhs.(types.String)
+					if !ok {
+						return types.MaybeNoSuchOverloadErr(rhs)
+					}
+					ip, _ := netaddr.Split(string(s))
+					return types.Bool(netaddr.Contains(c.network, ip))
+				}),
+			),
+		),
+	}
+}
+
+func (cidrLibrary) ProgramOptions() []cel.ProgramOption {
+	return nil
+}
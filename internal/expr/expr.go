@@ -0,0 +1,386 @@
+package expr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netaddr"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/spf13/viper"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type Kind string
+
+const (
+	KindTraffic Kind = "traffic"
+	KindAudit   Kind = "audit"
+)
+
+// Config is the expressions section of config.yaml.
+//
+//	expressions:
+//	  filters:
+//	    - name: large-egress
+//	      kind: traffic
+//	      action: drop
+//	      expr: 'meta.direction == "EGRESS" && meta.tx_bytes > 10000000'
+//	  fields:
+//	    - name: tx_mb
+//	      kind: traffic
+//	      expr: 'meta.tx_bytes / 1000000'
+//
+// Filters are evaluated in order and the first one that returns true decides
+// whether the event is kept ("include") or dropped ("drop"). Events no filter
+// matches are kept. Fields are added to the forwarded event.
+type Config struct {
+	Filters []FilterRule `mapstructure:"filters"`
+	Fields  []FieldRule  `mapstructure:"fields"`
+}
+
+type FilterRule struct {
+	Name   string `mapstructure:"name"`
+	Kind   Kind   `mapstructure:"kind"`
+	Action string `mapstructure:"action"`
+	Expr   string `mapstructure:"expr"`
+}
+
+type FieldRule struct {
+	Name string `mapstructure:"name"`
+	Kind Kind   `mapstructure:"kind"`
+	Expr string `mapstructure:"expr"`
+}
+
+type compiledFilter struct {
+	name string
+	kind Kind
+	drop bool
+	prg  cel.Program
+}
+
+type compiledField struct {
+	name string
+	kind Kind
+	prg  cel.Program
+}
+
+type Program struct {
+	filters []compiledFilter
+	fields  []compiledField
+}
+
+var current atomic.Pointer[Program]
+
+// Load compiles the expressions section of the current config and swaps it
+// in. On error the previously loaded expressions stay active.
+func Load() error {
+	var cfg Config
+	if err := viper.UnmarshalKey("expressions", &cfg); err != nil {
+		return fmt.Errorf("decode expressions config: %w", err)
+	}
+
+	prg, err := Compile(cfg)
+	if err != nil {
+		return err
+	}
+	current.Store(prg)
+	return nil
+}
+
+func Compile(cfg Config) (*Program, error) {
+	envs := make(map[Kind]*cel.Env)
+	for _, kind := range []Kind{KindTraffic, KindAudit} {
+		env, err := newEnv(kind)
+		if err != nil {
+			return nil, fmt.Errorf("create %s expression environment: %w", kind, err)
+		}
+		envs[kind] = env
+	}
+
+	p := &Program{}
+	for i, rule := range cfg.Filters {
+		where := ruleRef("filters", i, rule.Name)
+		kind, err := normaliseKind(rule.Kind)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		var drop bool
+		switch rule.Action {
+		case "drop":
+			drop = true
+		case "include", "":
+		default:
+			return nil, fmt.Errorf("%s: unknown action %q, want \"include\" or \"drop\"", where, rule.Action)
+		}
+
+		prg, err := compile(envs[kind], rule.Expr, cel.BoolType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		p.filters = append(p.filters, compiledFilter{name: ruleName(i, rule.Name), kind: kind, drop: drop, prg: prg})
+	}
+
+	for i, rule := range cfg.Fields {
+		where := ruleRef("fields", i, rule.Name)
+		if rule.Name == "" {
+			return nil, fmt.Errorf("%s: name is required", where)
+		}
+		kind, err := normaliseKind(rule.Kind)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		prg, err := compile(envs[kind], rule.Expr, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		p.fields = append(p.fields, compiledField{name: rule.Name, kind: kind, prg: prg})
+	}
+	return p, nil
+}
+
+func ruleRef(section string, i int, name string) string {
+	if name == "" {
+		return fmt.Sprintf("expressions.%s[%d]", section, i)
+	}
+	return fmt.Sprintf("expressions.%s[%d] %q", section, i, name)
+}
+
+func ruleName(i int, name string) string {
+	if name == "" {
+		return "#" + strconv.Itoa(i+1)
+	}
+	return name
+}
+
+func normaliseKind(k Kind) (Kind, error) {
+	switch k {
+	case "", KindTraffic:
+		return KindTraffic, nil
+	case KindAudit:
+		return KindAudit, nil
+	}
+	return "", fmt.Errorf("unknown kind %q, want %q or %q", k, KindTraffic, KindAudit)
+}
+
+func compile(env *cel.Env, src string, want *cel.Type) (cel.Program, error) {
+	if src == "" {
+		return nil, fmt.Errorf("expr is required")
+	}
+	ast, iss := env.Compile(src)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if want != nil && !ast.OutputType().IsExactType(want) && !ast.OutputType().IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("expression must return %s, got %s", want, ast.OutputType())
+	}
+	if err := checkCIDRLiterals(ast); err != nil {
+		return nil, err
+	}
+	return env.Program(ast)
+}
+
+func newEnv(kind Kind) (*cel.Env, error) {
+	opts := []cel.EnvOption{
+		cel.CrossTypeNumericComparisons(true),
+		cel.Variable("message", cel.StringType),
+		cel.Variable("timestamp", cel.TimestampType),
+		cel.Variable("meta", cel.MapType(cel.StringType, cel.DynType)),
+		cidrLib(),
+	}
+	switch kind {
+	case KindTraffic:
+		opts = append(opts,
+			cel.Variable("src_ip", cel.StringType),
+			cel.Variable("src_port", cel.IntType),
+			cel.Variable("dst_ip", cel.StringType),
+			cel.Variable("dst_port", cel.IntType),
+		)
+	case KindAudit:
+		opts = append(opts,
+			cel.Variable("id", cel.IntType),
+			cel.Variable("initiator_id", cel.StringType),
+			cel.Variable("target_id", cel.StringType),
+		)
+	}
+	return cel.NewEnv(opts...)
+}
+
+func trafficVars(ev apicontracts.TrafficEvent) map[string]any {
+	srcIP, srcPort := splitAddr(ev.Meta.SourceAddr)
+	dstIP, dstPort := splitAddr(ev.Meta.DestinationAddr)
+	return map[string]any{
+		"message":   ev.Message,
+		"timestamp": ev.Timestamp,
+		"meta":      toMap(ev.Meta),
+		"src_ip":    srcIP,
+		"src_port":  srcPort,
+		"dst_ip":    dstIP,
+		"dst_port":  dstPort,
+	}
+}
+
+func auditVars(ev apicontracts.AuditEventEnvelope) map[string]any {
+	meta := ev.Extra
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	return map[string]any{
+		"message":      ev.Message,
+		"timestamp":    ev.Timestamp,
+		"meta":         meta,
+		"id":           ev.ID,
+		"initiator_id": ev.InitiatorID,
+		"target_id":    ev.TargetID,
+	}
+}
+
+func splitAddr(addr string) (string, int) {
+	_, port := netaddr.Split(addr)
+	return netaddr.Host(addr), max(port, 0)
+}
+
+// toMap converts a struct to a map keyed by its JSON names, keeping integers
+// as integers so expressions can do integer arithmetic on them.
+func toMap(v any) map[string]any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil
+	}
+	for k, val := range m {
+		if n, ok := val.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				m[k] = i
+			} else if f, err := n.Float64(); err == nil {
+				m[k] = f
+			}
+		}
+	}
+	return m
+}
+
+// EvaluateTraffic runs the traffic filters and field expressions. It returns
+// false when the event should be dropped.
+func EvaluateTraffic(ev apicontracts.TrafficEvent) (bool, map[string]any) {
+	p := current.Load()
+	if p == nil {
+		return true, nil
+	}
+	return p.evaluate(KindTraffic, trafficVars(ev))
+}
+
+// EvaluateAudit runs the audit filters and field expressions. It returns
+// false when the event should be dropped.
+func EvaluateAudit(ev apicontracts.AuditEventEnvelope) (bool, map[string]any) {
+	p := current.Load()
+	if p == nil {
+		return true, nil
+	}
+	return p.evaluate(KindAudit, auditVars(ev))
+}
+
+func (p *Program) evaluate(kind Kind, vars map[string]any) (bool, map[string]any) {
+	for _, f := range p.filters {
+		if f.kind != kind {
+			continue
+		}
+		out, _, err := f.prg.Eval(vars)
+		if err != nil {
+			evalErrors.warn("filter", f.name, err)
+			continue
+		}
+		if out == types.True {
+			if f.drop {
+				return false, nil
+			}
+			break
+		}
+	}
+
+	var fields map[string]any
+	for _, f := range p.fields {
+		if f.kind != kind {
+			continue
+		}
+		out, _, err := f.prg.Eval(vars)
+		if err != nil {
+			evalErrors.warn("field", f.name, err)
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]any)
+		}
+		fields[f.name] = native(out)
+	}
+	return true, fields
+}
+
+// errorLog rate limits the warnings for rules that fail while running, e.g.
+// on every event lacking a field, so one bad rule cannot flood the log.
+type errorLog struct {
+	interval time.Duration
+
+	mu         sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]int
+}
+
+var evalErrors = newErrorLog(time.Minute)
+
+func newErrorLog(interval time.Duration) *errorLog {
+	return &errorLog{
+		interval:   interval,
+		last:       make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+func (l *errorLog) warn(what, name string, err error) {
+	key := what + " " + name
+	now := time.Now()
+
+	l.mu.Lock()
+	if t, ok := l.last[key]; ok && now.Sub(t) < l.interval {
+		l.suppressed[key]++
+		l.mu.Unlock()
+		return
+	}
+	l.last[key] = now
+	n := l.suppressed[key]
+	delete(l.suppressed, key)
+	l.mu.Unlock()
+
+	if n > 0 {
+		logger.Log.Warnf("Expression %s %s failed and was skipped: %v (%d more failures since the last warning)", what, name, err, n)
+		return
+	}
+	logger.Log.Warnf("Expression %s %s failed and was skipped: %v", what, name, err)
+}
+
+// native converts a CEL result into a plain Go value for JSON encoding.
+func native(v ref.Val) any {
+	switch v.Type() {
+	case types.BoolType, types.IntType, types.UintType, types.DoubleType, types.StringType:
+		return v.Value()
+	}
+	pb, err := v.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return fmt.Sprint(v.Value())
+	}
+	return pb.(*structpb.Value).AsInterface()
+}
@@ -0,0 +1,178 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observeLogs points logger.Log at an in-memory core for the test.
+func observeLogs(t *testing.T) *observer.ObservedLogs {
+	t.Helper()
+	core, logs := observer.New(zapcore.DebugLevel)
+	prev := logger.Log
+	logger.Log = zap.New(core).Sugar()
+	t.Cleanup(func() { logger.Log = prev })
+	return logs
+}
+
+func trafficEvent(direction string, txBytes int, dst string) apicontracts.TrafficEvent {
+	return apicontracts.TrafficEvent{
+		Message: "TYPE_START",
+		Meta: apicontracts.TrafficMeta{
+			Direction:       direction,
+			TxBytes:         txBytes,
+			SourceAddr:      "100.64.0.10:51234",
+			DestinationAddr: dst,
+		},
+	}
+}
+
+func TestCompileChecksCIDRLiterals(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{`cidr("10.0.0.0/8").contains(dst_ip)`, ""},
+		{`cidr("fd00::/8").contains(dst_ip)`, ""},
+		{`cidr("10.0.0.5").contains(dst_ip)`, ""},
+		{`cidr("10.0.0.0/33").contains(dst_ip)`, `invalid CIDR "10.0.0.0/33"`},
+		{`cidr("fd00::/129").contains(dst_ip)`, `invalid CIDR "fd00::/129"`},
+		{`src_port > 0 && cidr("not-a-network").contains(dst_ip)`, `invalid CIDR "not-a-network"`},
+		// Only literals can be checked up front.
+		{`cidr(meta.destination_name).contains(dst_ip)`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Compile(Config{Filters: []FilterRule{{Name: "net", Expr: tt.expr}}})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadKeepsPreviousRulesOnError(t *testing.T) {
+	t.Cleanup(func() {
+		current.Store(nil)
+		viper.Set("expressions", nil)
+	})
+
+	viper.Set("expressions", map[string]any{
+		"filters": []map[string]any{
+			{"name": "internal", "action": "drop", "expr": `cidr("10.0.0.0/8").contains(dst_ip)`},
+		},
+	})
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Set("expressions", map[string]any{
+		"filters": []map[string]any{
+			{"name": "internal", "action": "drop", "expr": `cidr("10.0.0.0/33").contains(dst_ip)`},
+		},
+	})
+	if err := Load(); err == nil {
+		t.Fatal("Load accepted an invalid CIDR literal")
+	}
+
+	if keep, _ := EvaluateTraffic(trafficEvent("EGRESS", 0, "10.1.2.3:443")); keep {
+		t.Error("previous rules were replaced by the rejected ones")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	prg, err := Compile(Config{
+		Filters: []FilterRule{
+			{Name: "keep-ingress", Action: "include", Expr: `meta.direction == "INGRESS"`},
+			{Name: "large-egress", Action: "drop", Expr: `meta.tx_bytes > 1000`},
+			{Name: "audit-noise", Kind: KindAudit, Action: "drop", Expr: `message == "noise"`},
+		},
+		Fields: []FieldRule{
+			{Name: "tx_kb", Expr: `meta.tx_bytes / 1000`},
+			{Name: "internal", Expr: `cidr("10.0.0.0/8").contains(dst_ip)`},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		ev         apicontracts.TrafficEvent
+		wantKeep   bool
+		wantFields map[string]any
+	}{
+		{"small egress", trafficEvent("EGRESS", 500, "10.0.0.5:443"), true, map[string]any{"tx_kb": int64(0), "internal": true}},
+		{"large egress", trafficEvent("EGRESS", 5000, "192.0.2.1:443"), false, nil},
+		{"large ingress matches include first", trafficEvent("INGRESS", 5000, "[fd00::1]:22"), true, map[string]any{"tx_kb": int64(5), "internal": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, fields := prg.evaluate(KindTraffic, trafficVars(tt.ev))
+			if keep != tt.wantKeep {
+				t.Fatalf("keep = %t, want %t", keep, tt.wantKeep)
+			}
+			if len(fields) != len(tt.wantFields) {
+				t.Fatalf("fields = %v, want %v", fields, tt.wantFields)
+			}
+			for k, want := range tt.wantFields {
+				if fields[k] != want {
+					t.Errorf("fields[%s] = %#v, want %#v", k, fields[k], want)
+				}
+			}
+		})
+	}
+
+	keep, _ := prg.evaluate(KindAudit, auditVars(apicontracts.AuditEventEnvelope{Message: "noise"}))
+	if keep {
+		t.Error("audit filter not applied")
+	}
+}
+
+func TestEvalErrorsAreWarnedAndRateLimited(t *testing.T) {
+	logs := observeLogs(t)
+	prev := evalErrors
+	evalErrors = newErrorLog(50 * time.Millisecond)
+	t.Cleanup(func() { evalErrors = prev })
+
+	prg, err := Compile(Config{Fields: []FieldRule{{Name: "bad", Expr: `meta.no_such_field + 1`}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := trafficVars(trafficEvent("EGRESS", 0, "10.0.0.5:443"))
+
+	for range 3 {
+		prg.evaluate(KindTraffic, vars)
+	}
+	warnings := logs.FilterLevelExact(zapcore.WarnLevel)
+	if warnings.Len() != 1 {
+		t.Fatalf("got %d warnings for 3 failures, want 1", warnings.Len())
+	}
+	if msg := warnings.All()[0].Message; !strings.Contains(msg, "field bad") {
+		t.Errorf("warning does not name the rule: %s", msg)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	prg.evaluate(KindTraffic, vars)
+	all := logs.FilterLevelExact(zapcore.WarnLevel).All()
+	if len(all) != 2 {
+		t.Fatalf("got %d warnings, want 2", len(all))
+	}
+	if msg := all[1].Message; !strings.Contains(msg, "2 more failures") {
+		t.Errorf("suppressed failures not reported: %s", msg)
+	}
+}
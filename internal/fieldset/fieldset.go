@@ -0,0 +1,96 @@
+package fieldset
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/spf13/viper"
+)
+
+// Config is the output_fields section of config.yaml.
+//
+//	output_fields:
+//	  traffic:
+//	    exclude: [received_timestamp, reporter_id]
+//
+// Names are the JSON keys of the forwarded traffic event. With an empty
+// include list every field is forwarded. Fields added by expressions are
+// always forwarded. Only the native output profile applies the field set.
+type Config struct {
+	Traffic List `mapstructure:"traffic"`
+}
+
+type List struct {
+	Include []string `mapstructure:"include"`
+	Exclude []string `mapstructure:"exclude"`
+}
+
+var traffic atomic.Pointer[apicontracts.FieldSet]
+
+// Load compiles the output_fields section of the current config and swaps it
+// in. On error the previous field set stays active.
+func Load() error {
+	var cfg Config
+	if err := viper.UnmarshalKey("output_fields", &cfg); err != nil {
+		return fmt.Errorf("decode output_fields config: %w", err)
+	}
+
+	set, err := Compile(cfg.Traffic, TrafficFields())
+	if err != nil {
+		return fmt.Errorf("output_fields.traffic: %w", err)
+	}
+	traffic.Store(set)
+	return nil
+}
+
+// Compile checks the names against known and returns the field set, or nil
+// when the lists are empty.
+func Compile(list List, known []string) (*apicontracts.FieldSet, error) {
+	if len(list.Include) == 0 && len(list.Exclude) == 0 {
+		return nil, nil
+	}
+	valid := make(map[string]bool, len(known))
+	for _, name := range known {
+		valid[name] = true
+	}
+
+	set := &apicontracts.FieldSet{Include: map[string]bool{}, Exclude: map[string]bool{}}
+	for _, lists := range []struct {
+		names []string
+		into  map[string]bool
+	}{{list.Include, set.Include}, {list.Exclude, set.Exclude}} {
+		for _, name := range lists.names {
+			if !valid[name] {
+				return nil, fmt.Errorf("unknown field %q, want one of %s", name, strings.Join(known, ", "))
+			}
+			lists.into[name] = true
+		}
+	}
+	return set, nil
+}
+
+// Traffic returns the field set for traffic events, nil meaning all fields.
+func Traffic() *apicontracts.FieldSet {
+	return traffic.Load()
+}
+
+// TrafficFields lists the JSON keys of SplunkTrafficEvent.
+func TrafficFields() []string {
+	return jsonNames(reflect.TypeOf(apicontracts.SplunkTrafficEvent{}))
+}
+
+func jsonNames(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
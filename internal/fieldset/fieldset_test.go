@@ -0,0 +1,103 @@
+package fieldset
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/spf13/viper"
+)
+
+func TestTrafficFields(t *testing.T) {
+	fields := TrafficFields()
+	for _, want := range []string{"src_ip", "dst_port", "protocol"} {
+		if !slices.Contains(fields, want) {
+			t.Errorf("%s missing from %v", want, fields)
+		}
+	}
+	if slices.Contains(fields, "") || slices.Contains(fields, "-") || !slices.IsSorted(fields) {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+func TestCompile(t *testing.T) {
+	if set, err := Compile(List{}, TrafficFields()); set != nil || err != nil {
+		t.Fatalf("empty lists = %v, %v; want nil", set, err)
+	}
+	if _, err := Compile(List{Exclude: []string{"src_ipaddr"}}, TrafficFields()); err == nil || !strings.Contains(err.Error(), "src_ipaddr") {
+		t.Fatalf("unknown field error = %v", err)
+	}
+}
+
+// The field set is applied when the event is marshalled for the sinks.
+func TestFieldSetLimitsForwardedKeys(t *testing.T) {
+	ev := apicontracts.SplunkTrafficEvent{
+		Protocol: "tcp",
+		SrcIP:    "100.64.0.10",
+		DstIP:    "10.0.0.5",
+		DstPort:  443,
+		Fields:   map[string]any{"zone": "prod"},
+	}
+	tests := []struct {
+		name    string
+		list    List
+		want    []string
+		notWant []string
+	}{
+		{"include", List{Include: []string{"src_ip", "dst_ip"}}, []string{"src_ip", "dst_ip", "zone"}, []string{"protocol", "dst_port"}},
+		{"exclude", List{Exclude: []string{"dst_port"}}, []string{"src_ip", "protocol", "zone"}, []string{"dst_port"}},
+		{"exclude wins over include", List{Include: []string{"src_ip", "dst_ip"}, Exclude: []string{"dst_ip"}}, []string{"src_ip"}, []string{"dst_ip"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := Compile(tt.list, TrafficFields())
+			if err != nil {
+				t.Fatal(err)
+			}
+			ev.FieldSet = set
+			b, err := json.Marshal(ev)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			for _, k := range tt.want {
+				if _, ok := got[k]; !ok {
+					t.Errorf("%s missing from %s", k, b)
+				}
+			}
+			for _, k := range tt.notWant {
+				if _, ok := got[k]; ok {
+					t.Errorf("%s forwarded in %s", k, b)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadKeepsPreviousSetOnError(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Set("output_fields", nil)
+		traffic.Store(nil)
+	})
+
+	viper.Set("output_fields", map[string]any{"traffic": map[string]any{"exclude": []string{"reporter_id"}}})
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if Traffic().Keep("reporter_id") {
+		t.Fatal("reporter_id not excluded")
+	}
+
+	viper.Set("output_fields", map[string]any{"traffic": map[string]any{"include": []string{"nope"}}})
+	if err := Load(); err == nil {
+		t.Fatal("Load accepted an unknown field")
+	}
+	if Traffic().Keep("reporter_id") {
+		t.Error("previous field set replaced after a failed load")
+	}
+}
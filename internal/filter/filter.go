@@ -0,0 +1,331 @@
+package filter
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/protocols"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/match"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netaddr"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/spf13/viper"
+)
+
+type Action string
+
+const (
+	Include Action = "include"
+	Drop    Action = "drop"
+)
+
+// Config is the filter section of config.yaml. Rules are evaluated in order
+// and the first matching rule decides; DefaultAction applies when none match.
+type Config struct {
+	DefaultAction Action `mapstructure:"default_action"`
+	Rules         []Rule `mapstructure:"rules"`
+}
+
+type Rule struct {
+	Name   string `mapstructure:"name"`
+	Action Action `mapstructure:"action"`
+	Match  Match  `mapstructure:"match"`
+}
+
+// Match lists the conditions of a rule. Empty lists match anything, values
+// within a list are OR'ed and the lists are AND'ed together. Names accept
+// shell-style globs.
+type Match struct {
+	MessageTypes     []string `mapstructure:"message_types"`
+	Directions       []string `mapstructure:"directions"`
+	SourceTypes      []string `mapstructure:"source_types"`
+	DestinationTypes []string `mapstructure:"destination_types"`
+	SourceCIDRs      []string `mapstructure:"source_cidrs"`
+	DestinationCIDRs []string `mapstructure:"destination_cidrs"`
+	SourcePorts      []string `mapstructure:"source_ports"`
+	DestinationPorts []string `mapstructure:"destination_ports"`
+	Protocols        []string `mapstructure:"protocols"`
+	PolicyNames      []string `mapstructure:"policy_names"`
+	SourceNames      []string `mapstructure:"source_names"`
+	DestinationNames []string `mapstructure:"destination_names"`
+	UserEmails       []string `mapstructure:"user_emails"`
+}
+
+// DefaultConfig reproduces the original hard-coded behaviour: forward ingress
+// traffic to named peers outside the NetBird overlay range.
+func DefaultConfig() Config {
+	return Config{
+		DefaultAction: Drop,
+		Rules: []Rule{
+			{Name: "drop-overlay-destinations", Action: Drop, Match: Match{DestinationCIDRs: []string{"100.110.0.0/16"}}},
+			{Name: "drop-unnamed-destinations", Action: Drop, Match: Match{DestinationNames: []string{""}}},
+			{Name: "ingress-to-peers", Action: Include, Match: Match{Directions: []string{"INGRESS"}, DestinationTypes: []string{"PEER"}}},
+		},
+	}
+}
+
+type compiledRule struct {
+	name   string
+	action Action
+
+	messageTypes     []string
+	directions       []string
+	sourceTypes      []string
+	destinationTypes []string
+	sourceNets       []netip.Prefix
+	destinationNets  []netip.Prefix
+	sourcePorts      []match.PortRange
+	destinationPorts []match.PortRange
+	protocols        map[int]struct{}
+	policyNames      []string
+	sourceNames      []string
+	destinationNames []string
+	userEmails       []string
+}
+
+type Engine struct {
+	rules         []compiledRule
+	defaultAction Action
+}
+
+var current atomic.Pointer[Engine]
+
+// Load compiles the filter section of the current config and swaps it in.
+// On error the previously loaded rules stay active.
+func Load() error {
+	cfg := DefaultConfig()
+	if viper.IsSet("filter") {
+		cfg = Config{}
+		if err := viper.UnmarshalKey("filter", &cfg); err != nil {
+			return fmt.Errorf("decode filter config: %w", err)
+		}
+	}
+
+	engine, err := Compile(cfg)
+	if err != nil {
+		return err
+	}
+	current.Store(engine)
+	return nil
+}
+
+func Compile(cfg Config) (*Engine, error) {
+	engine := &Engine{defaultAction: cfg.DefaultAction}
+	if engine.defaultAction == "" {
+		engine.defaultAction = Drop
+	}
+	if err := validAction(engine.defaultAction); err != nil {
+		return nil, fmt.Errorf("filter default_action: %w", err)
+	}
+
+	for i, rule := range cfg.Rules {
+		name := rule.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		compiled, err := compileRule(name, rule)
+		if err != nil {
+			return nil, fmt.Errorf("filter rule %s: %w", name, err)
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+	return engine, nil
+}
+
+func validAction(a Action) error {
+	if a != Include && a != Drop {
+		return fmt.Errorf("unknown action %q, want %q or %q", a, Include, Drop)
+	}
+	return nil
+}
+
+func compileRule(name string, rule Rule) (compiledRule, error) {
+	if err := validAction(rule.Action); err != nil {
+		return compiledRule{}, err
+	}
+
+	m := rule.Match
+	c := compiledRule{
+		name:             name,
+		action:           rule.Action,
+		messageTypes:     upper(m.MessageTypes),
+		directions:       upper(m.Directions),
+		sourceTypes:      upper(m.SourceTypes),
+		destinationTypes: upper(m.DestinationTypes),
+		policyNames:      m.PolicyNames,
+		sourceNames:      m.SourceNames,
+		destinationNames: m.DestinationNames,
+		userEmails:       m.UserEmails,
+	}
+
+	var err error
+	if c.sourceNets, err = parseCIDRs(m.SourceCIDRs); err != nil {
+		return compiledRule{}, fmt.Errorf("source_cidrs: %w", err)
+	}
+	if c.destinationNets, err = parseCIDRs(m.DestinationCIDRs); err != nil {
+		return compiledRule{}, fmt.Errorf("destination_cidrs: %w", err)
+	}
+	if c.sourcePorts, err = match.ParsePorts(m.SourcePorts); err != nil {
+		return compiledRule{}, fmt.Errorf("source_ports: %w", err)
+	}
+	if c.destinationPorts, err = match.ParsePorts(m.DestinationPorts); err != nil {
+		return compiledRule{}, fmt.Errorf("destination_ports: %w", err)
+	}
+	if c.protocols, err = parseProtocols(m.Protocols); err != nil {
+		return compiledRule{}, fmt.Errorf("protocols: %w", err)
+	}
+	for _, patterns := range [][]string{c.policyNames, c.sourceNames, c.destinationNames, c.userEmails} {
+		if err := match.ValidateGlobs(patterns); err != nil {
+			return compiledRule{}, err
+		}
+	}
+	return c, nil
+}
+
+func upper(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToUpper(v)
+	}
+	return out
+}
+
+func parseCIDRs(values []string) ([]netip.Prefix, error) {
+	var nets []netip.Prefix
+	for _, v := range values {
+		network, err := netaddr.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+func parseProtocols(values []string) (map[int]struct{}, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	set := make(map[int]struct{})
+	for _, v := range values {
+		if n, err := strconv.Atoi(v); err == nil {
+			set[n] = struct{}{}
+			continue
+		}
+		found := false
+		for n, name := range protocols.ProtocolsMap {
+			if strings.EqualFold(name, v) {
+				set[n] = struct{}{}
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown protocol %q", v)
+		}
+	}
+	return set, nil
+}
+
+// Evaluate returns the action for a traffic event and the name of the rule
+// that decided it ("default" if none matched). userEmail is only called when
+// a rule matches on user_emails, since resolving it needs a cache lookup.
+func Evaluate(ev apicontracts.TrafficEvent, userEmail func() string) (Action, string) {
+	engine := current.Load()
+	if engine == nil {
+		if err := Load(); err != nil {
+			return Drop, "invalid-config"
+		}
+		engine = current.Load()
+	}
+	return engine.Evaluate(ev, userEmail)
+}
+
+func (e *Engine) Evaluate(ev apicontracts.TrafficEvent, userEmail func() string) (Action, string) {
+	flow := newFlow(ev, userEmail)
+	for _, rule := range e.rules {
+		if rule.matches(flow) {
+			return rule.action, rule.name
+		}
+	}
+	return e.defaultAction, "default"
+}
+
+// flow is the event flattened into the values rules match on.
+type flow struct {
+	ev        apicontracts.TrafficEvent
+	srcIP     netip.Addr
+	srcPort   int
+	dstIP     netip.Addr
+	dstPort   int
+	userEmail func() string
+	resolved  *string
+}
+
+func newFlow(ev apicontracts.TrafficEvent, userEmail func() string) *flow {
+	f := &flow{ev: ev, userEmail: userEmail}
+	f.srcIP, f.srcPort = netaddr.Split(ev.Meta.SourceAddr)
+	f.dstIP, f.dstPort = netaddr.Split(ev.Meta.DestinationAddr)
+	return f
+}
+
+func (f *flow) email() string {
+	if f.resolved == nil {
+		email := ""
+		if f.userEmail != nil {
+			email = f.userEmail()
+		}
+		f.resolved = &email
+	}
+	return *f.resolved
+}
+
+func (r compiledRule) matches(f *flow) bool {
+	meta := f.ev.Meta
+	return matchExact(r.messageTypes, strings.ToUpper(f.ev.Message)) &&
+		matchExact(r.directions, strings.ToUpper(meta.Direction)) &&
+		matchExact(r.sourceTypes, strings.ToUpper(meta.SourceType)) &&
+		matchExact(r.destinationTypes, strings.ToUpper(meta.DestinationType)) &&
+		matchNets(r.sourceNets, f.srcIP) &&
+		matchNets(r.destinationNets, f.dstIP) &&
+		match.Ports(r.sourcePorts, f.srcPort) &&
+		match.Ports(r.destinationPorts, f.dstPort) &&
+		matchProtocol(r.protocols, meta.Protocol) &&
+		match.Glob(r.policyNames, meta.PolicyName) &&
+		match.Glob(r.sourceNames, meta.SourceName) &&
+		match.Glob(r.destinationNames, meta.DestinationName) &&
+		(len(r.userEmails) == 0 || match.Glob(r.userEmails, f.email()))
+}
+
+func matchExact(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, want := range values {
+		if want == v {
+			return true
+		}
+	}
+	return false
+}
+
+func matchNets(nets []netip.Prefix, ip netip.Addr) bool {
+	if len(nets) == 0 {
+		return true
+	}
+	for _, n := range nets {
+		if netaddr.Contains(n, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchProtocol(set map[int]struct{}, proto int) bool {
+	if set == nil {
+		return true
+	}
+	_, ok := set[proto]
+	return ok
+}
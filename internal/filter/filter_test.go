@@ -0,0 +1,163 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/spf13/viper"
+)
+
+func event() apicontracts.TrafficEvent {
+	return apicontracts.TrafficEvent{
+		Message: "TYPE_START",
+		Meta: apicontracts.TrafficMeta{
+			Direction:       "INGRESS",
+			SourceType:      "PEER",
+			SourceName:      "laptop-1",
+			SourceAddr:      "100.64.0.10:51234",
+			DestinationType: "PEER",
+			DestinationName: "db-1",
+			DestinationAddr: "10.0.0.5:5432",
+			Protocol:        6,
+			PolicyName:      "Developers to databases",
+		},
+	}
+}
+
+func TestDefaultConfig(t *testing.T) {
+	engine, err := Compile(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		modify   func(*apicontracts.TrafficEvent)
+		want     Action
+		wantRule string
+	}{
+		{"ingress to named peer", func(*apicontracts.TrafficEvent) {}, Include, "ingress-to-peers"},
+		{"overlay destination", func(ev *apicontracts.TrafficEvent) { ev.Meta.DestinationAddr = "100.110.1.2:22" }, Drop, "drop-overlay-destinations"},
+		{"unnamed destination", func(ev *apicontracts.TrafficEvent) { ev.Meta.DestinationName = "" }, Drop, "drop-unnamed-destinations"},
+		{"egress", func(ev *apicontracts.TrafficEvent) { ev.Meta.Direction = "EGRESS" }, Drop, "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := event()
+			tt.modify(&ev)
+			if action, rule := engine.Evaluate(ev, nil); action != tt.want || rule != tt.wantRule {
+				t.Errorf("Evaluate = %s by %s, want %s by %s", action, rule, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		match Match
+		want  bool
+	}{
+		{"empty matches anything", Match{}, true},
+		{"case insensitive type", Match{MessageTypes: []string{"type_start"}}, true},
+		{"values are OR'ed", Match{Directions: []string{"EGRESS", "INGRESS"}}, true},
+		{"conditions are AND'ed", Match{Directions: []string{"INGRESS"}, SourceTypes: []string{"HOST_RESOURCE"}}, false},
+		{"source cidr", Match{SourceCIDRs: []string{"100.64.0.0/10"}}, true},
+		{"destination host", Match{DestinationCIDRs: []string{"10.0.0.5"}}, true},
+		{"destination cidr miss", Match{DestinationCIDRs: []string{"192.168.0.0/16"}}, false},
+		{"port", Match{DestinationPorts: []string{"5432"}}, true},
+		{"port range", Match{SourcePorts: []string{"49152 - 65535"}}, true},
+		{"port miss", Match{DestinationPorts: []string{"80", "443"}}, false},
+		{"protocol by name", Match{Protocols: []string{"TCP"}}, true},
+		{"protocol by number", Match{Protocols: []string{"17"}}, false},
+		{"glob on policy", Match{PolicyNames: []string{"Developers *"}}, true},
+		{"glob on name", Match{SourceNames: []string{"laptop-?"}}, true},
+		{"glob miss", Match{DestinationNames: []string{"web-*"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := compileRule(tt.name, Rule{Action: Include, Match: tt.match})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rule.matches(newFlow(event(), nil)); got != tt.want {
+				t.Errorf("matches = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserEmailOnlyResolvedWhenNeeded(t *testing.T) {
+	calls := 0
+	email := func() string {
+		calls++
+		return "alice@example.com"
+	}
+	engine, err := Compile(Config{Rules: []Rule{
+		{Name: "egress", Action: Drop, Match: Match{Directions: []string{"EGRESS"}}},
+		{Name: "admins", Action: Include, Match: Match{UserEmails: []string{"admin@*"}}},
+		{Name: "example", Action: Include, Match: Match{UserEmails: []string{"*@example.com"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	egress := event()
+	egress.Meta.Direction = "EGRESS"
+	if action, _ := engine.Evaluate(egress, email); action != Drop || calls != 0 {
+		t.Fatalf("Evaluate = %s after %d lookups, want drop without lookup", action, calls)
+	}
+	if action, rule := engine.Evaluate(event(), email); action != Include || rule != "example" {
+		t.Fatalf("Evaluate = %s by %s, want include by example", action, rule)
+	}
+	if calls != 1 {
+		t.Errorf("email looked up %d times, want once", calls)
+	}
+}
+
+func TestCompileRejectsBadRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"bad default", Config{DefaultAction: "allow"}, "default_action"},
+		{"bad action", Config{Rules: []Rule{{Action: "allow"}}}, "rule #1"},
+		{"bad cidr", Config{Rules: []Rule{{Name: "a", Action: Drop, Match: Match{SourceCIDRs: []string{"10.0.0.0/33"}}}}}, "source_cidrs"},
+		{"bad port", Config{Rules: []Rule{{Name: "b", Action: Drop, Match: Match{DestinationPorts: []string{"https"}}}}}, "destination_ports"},
+		{"reversed range", Config{Rules: []Rule{{Name: "c", Action: Drop, Match: Match{SourcePorts: []string{"443-80"}}}}}, "invalid port range"},
+		{"port out of range", Config{Rules: []Rule{{Name: "c", Action: Drop, Match: Match{DestinationPorts: []string{"65536"}}}}}, "invalid port"},
+		{"unknown protocol", Config{Rules: []Rule{{Name: "d", Action: Drop, Match: Match{Protocols: []string{"quic"}}}}}, "unknown protocol"},
+		{"bad pattern", Config{Rules: []Rule{{Name: "e", Action: Drop, Match: Match{PolicyNames: []string{"["}}}}}, "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// A port outside 0-65535 fails the load and keeps the previous rules.
+func TestLoadRejectsBadPorts(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Set("filter", nil)
+		current.Store(nil)
+	})
+	viper.Set("filter", map[string]any{"default_action": "include"})
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Set("filter", map[string]any{"default_action": "include", "rules": []map[string]any{
+		{"name": "high", "action": "drop", "match": map[string]any{"source_ports": []string{"1024-65536"}}},
+	}})
+	if err := Load(); err == nil || !strings.Contains(err.Error(), "source_ports") {
+		t.Fatalf("Load error = %v, want the out of range port rejected", err)
+	}
+	if action, rule := Evaluate(event(), nil); action != Include || rule != "default" {
+		t.Errorf("Evaluate = %s by %s after a failed load, want the previous default", action, rule)
+	}
+}
@@ -0,0 +1,269 @@
+package flows
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/metrics"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/sinks"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/spf13/viper"
+)
+
+// Final states of an emitted flow.
+const (
+	StateCompleted  = "completed"
+	StateDropped    = "dropped"
+	StateTimeout    = "timeout"
+	StateEvicted    = "evicted"
+	StateIncomplete = "incomplete"
+)
+
+// Config is the flows section of config.yaml.
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// IdleTimeout emits a flow that has seen no events for this long.
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+	// MaxFlows bounds the number of open flows. When reached, the least
+	// recently updated flow is emitted as evicted.
+	MaxFlows int `mapstructure:"max_flows"`
+	// LateWindow is how long the FlowID of an ended or dropped flow is
+	// remembered. Events for it in that time are late and dropped instead of
+	// opening a new flow.
+	LateWindow time.Duration `mapstructure:"late_window"`
+	// EmitRaw keeps forwarding the individual traffic events as well.
+	EmitRaw bool `mapstructure:"emit_raw"`
+}
+
+// EmitFunc receives every finished flow.
+type EmitFunc func(apicontracts.SplunkFlowEvent)
+
+type flow struct {
+	event    apicontracts.SplunkFlowEvent
+	lastSeen time.Time
+}
+
+type tombstone struct {
+	flowID string
+	ended  time.Time
+}
+
+// Aggregator merges the start, end and drop events of a connection into one
+// flow record, keyed by FlowID.
+type Aggregator struct {
+	cfg  Config
+	emit EmitFunc
+
+	mu    sync.Mutex
+	flows map[string]*list.Element
+	lru   *list.List // front is the most recently updated flow
+
+	ended      map[string]*list.Element
+	tombstones *list.List // front is the most recently ended flow
+}
+
+var GlobalAggregator *Aggregator
+
+func New(cfg Config, emit EmitFunc) *Aggregator {
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 5 * time.Minute
+	}
+	if cfg.MaxFlows <= 0 {
+		cfg.MaxFlows = 100000
+	}
+	if cfg.LateWindow <= 0 {
+		cfg.LateWindow = time.Minute
+	}
+	return &Aggregator{
+		cfg:        cfg,
+		emit:       emit,
+		flows:      make(map[string]*list.Element),
+		lru:        list.New(),
+		ended:      make(map[string]*list.Element),
+		tombstones: list.New(),
+	}
+}
+
+// Init sets GlobalAggregator from the flows section when aggregation is
+// enabled. Flows are sent to sinks.GlobalSinks.
+func Init() error {
+	var cfg Config
+	if err := viper.UnmarshalKey("flows", &cfg); err != nil {
+		return err
+	}
+	if !cfg.Enabled {
+		GlobalAggregator = nil
+		return nil
+	}
+	GlobalAggregator = New(cfg, func(ev apicontracts.SplunkFlowEvent) {
+		if err := sinks.GlobalSinks.Send(context.Background(), sinks.FlowEvent(ev.Start, ev)); err != nil {
+			logger.Log.Errorf("Failed to forward flow %s: %v", ev.FlowID, err)
+		}
+	})
+	logger.Log.Infof("Flow aggregation enabled (idle timeout %s, max %d flows)", GlobalAggregator.cfg.IdleTimeout, GlobalAggregator.cfg.MaxFlows)
+	return nil
+}
+
+// EmitRaw reports whether the individual traffic events should still be
+// forwarded.
+func EmitRaw() bool {
+	return GlobalAggregator == nil || GlobalAggregator.cfg.EmitRaw
+}
+
+// Observe adds a traffic event to its flow. enriched is the event as it would
+// be forwarded on its own. Events without a FlowID are ignored, and so are
+// events for a flow that ended within LateWindow.
+func (a *Aggregator) Observe(ev apicontracts.TrafficEvent, enriched apicontracts.SplunkTrafficEvent) {
+	if ev.Meta.FlowID == "" {
+		return
+	}
+
+	var done []apicontracts.SplunkFlowEvent
+	a.mu.Lock()
+	if _, late := a.ended[ev.Meta.FlowID]; late {
+		a.mu.Unlock()
+		metrics.FlowsLateEvents.Inc()
+		return
+	}
+	elem, ok := a.flows[ev.Meta.FlowID]
+	if !ok {
+		if a.lru.Len() >= a.cfg.MaxFlows {
+			done = append(done, a.remove(a.lru.Back(), StateEvicted))
+			metrics.FlowsEvicted.Inc()
+		}
+		elem = a.lru.PushFront(&flow{event: apicontracts.SplunkFlowEvent{
+			FlowID:  ev.Meta.FlowID,
+			Start:   ev.Timestamp,
+			End:     ev.Timestamp,
+			Traffic: enriched,
+		}})
+		a.flows[ev.Meta.FlowID] = elem
+	} else {
+		a.lru.MoveToFront(elem)
+	}
+
+	f := elem.Value.(*flow)
+	f.lastSeen = time.Now()
+	f.event.EventCount++
+	if ev.Timestamp.Before(f.event.Start) {
+		f.event.Start = ev.Timestamp
+	}
+	if ev.Timestamp.After(f.event.End) {
+		f.event.End = ev.Timestamp
+	}
+	// Tellerne er kumulative, så den høyeste verdien er totalen.
+	f.event.RxBytes = max(f.event.RxBytes, ev.Meta.RxBytes)
+	f.event.TxBytes = max(f.event.TxBytes, ev.Meta.TxBytes)
+	f.event.RxPackets = max(f.event.RxPackets, ev.Meta.RxPackets)
+	f.event.TxPackets = max(f.event.TxPackets, ev.Meta.TxPackets)
+	f.event.Traffic.Message = enriched.Message
+
+	switch strings.ToUpper(ev.Message) {
+	case "TYPE_END":
+		done = append(done, a.remove(elem, StateCompleted))
+		a.bury(ev.Meta.FlowID, f.lastSeen)
+	case "TYPE_DROP":
+		done = append(done, a.remove(elem, StateDropped))
+		a.bury(ev.Meta.FlowID, f.lastSeen)
+	}
+	metrics.FlowsActive.Set(float64(a.lru.Len()))
+	a.mu.Unlock()
+
+	a.emitAll(done)
+}
+
+// Sweep emits the flows that have been idle longer than IdleTimeout and
+// forgets the flows that ended more than LateWindow ago.
+func (a *Aggregator) Sweep(now time.Time) {
+	var done []apicontracts.SplunkFlowEvent
+	a.mu.Lock()
+	for elem := a.tombstones.Back(); elem != nil; {
+		if now.Sub(elem.Value.(*tombstone).ended) < a.cfg.LateWindow {
+			break
+		}
+		prev := elem.Prev()
+		a.unbury(elem)
+		elem = prev
+	}
+	for elem := a.lru.Back(); elem != nil; {
+		if now.Sub(elem.Value.(*flow).lastSeen) < a.cfg.IdleTimeout {
+			break
+		}
+		prev := elem.Prev()
+		done = append(done, a.remove(elem, StateTimeout))
+		elem = prev
+	}
+	metrics.FlowsActive.Set(float64(a.lru.Len()))
+	a.mu.Unlock()
+
+	a.emitAll(done)
+}
+
+// Run sweeps idle flows until ctx is cancelled.
+func (a *Aggregator) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(a.cfg.IdleTimeout/4, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			a.Sweep(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close emits every open flow as incomplete.
+func (a *Aggregator) Close() {
+	var done []apicontracts.SplunkFlowEvent
+	a.mu.Lock()
+	for a.lru.Len() > 0 {
+		done = append(done, a.remove(a.lru.Back(), StateIncomplete))
+	}
+	metrics.FlowsActive.Set(0)
+	a.mu.Unlock()
+
+	a.emitAll(done)
+}
+
+func (a *Aggregator) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lru.Len()
+}
+
+// remove must be called with mu held.
+func (a *Aggregator) remove(elem *list.Element, state string) apicontracts.SplunkFlowEvent {
+	f := a.lru.Remove(elem).(*flow)
+	delete(a.flows, f.event.FlowID)
+
+	f.event.State = state
+	f.event.Duration = f.event.End.Sub(f.event.Start).Seconds()
+	metrics.FlowsEmitted.WithLabelValues(state).Inc()
+	return f.event
+}
+
+// bury remembers that flowID has ended. The tombstones are bounded by
+// MaxFlows like the open flows. Must be called with mu held.
+func (a *Aggregator) bury(flowID string, at time.Time) {
+	if a.tombstones.Len() >= a.cfg.MaxFlows {
+		a.unbury(a.tombstones.Back())
+	}
+	a.ended[flowID] = a.tombstones.PushFront(&tombstone{flowID: flowID, ended: at})
+}
+
+// unbury must be called with mu held.
+func (a *Aggregator) unbury(elem *list.Element) {
+	delete(a.ended, a.tombstones.Remove(elem).(*tombstone).flowID)
+}
+
+func (a *Aggregator) emitAll(events []apicontracts.SplunkFlowEvent) {
+	for _, ev := range events {
+		a.emit(ev)
+	}
+}
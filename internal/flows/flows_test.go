@@ -0,0 +1,189 @@
+package flows
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+var start = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// collector is an EmitFunc that keeps the emitted flows.
+type collector struct {
+	mu    sync.Mutex
+	flows []apicontracts.SplunkFlowEvent
+}
+
+func (c *collector) emit(ev apicontracts.SplunkFlowEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flows = append(c.flows, ev)
+}
+
+func (c *collector) states() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	states := make(map[string]string, len(c.flows))
+	for _, f := range c.flows {
+		states[f.FlowID] = f.State
+	}
+	return states
+}
+
+func step(flowID, typ string, at time.Duration, rx int) (apicontracts.TrafficEvent, apicontracts.SplunkTrafficEvent) {
+	ev := apicontracts.TrafficEvent{
+		Message:   typ,
+		Timestamp: start.Add(at),
+		Meta:      apicontracts.TrafficMeta{FlowID: flowID, RxBytes: rx, TxBytes: rx / 2},
+	}
+	return ev, apicontracts.SplunkTrafficEvent{Message: typ}
+}
+
+func TestObserveMergesFlow(t *testing.T) {
+	c := &collector{}
+	a := New(Config{}, c.emit)
+
+	// The end event arrives before a late start event, and the counters are
+	// cumulative so the largest value wins.
+	a.Observe(step("f1", "TYPE_START", time.Second, 100))
+	a.Observe(step("f1", "TYPE_START", 0, 50))
+	if len(c.flows) != 0 || a.Len() != 1 {
+		t.Fatalf("emitted %d flows with %d open, want 0 and 1", len(c.flows), a.Len())
+	}
+	a.Observe(step("f1", "TYPE_END", 90*time.Second, 300))
+
+	if len(c.flows) != 1 || a.Len() != 0 {
+		t.Fatalf("emitted %d flows with %d open, want 1 and 0", len(c.flows), a.Len())
+	}
+	f := c.flows[0]
+	if f.State != StateCompleted || f.EventCount != 3 || f.Duration != 90 {
+		t.Errorf("flow state %s, %d events, %vs; want completed, 3, 90s", f.State, f.EventCount, f.Duration)
+	}
+	if !f.Start.Equal(start) || f.RxBytes != 300 || f.TxBytes != 150 {
+		t.Errorf("flow start %v rx %d tx %d", f.Start, f.RxBytes, f.TxBytes)
+	}
+	if f.Traffic.Message != "TYPE_END" {
+		t.Errorf("traffic message = %q, want the last event", f.Traffic.Message)
+	}
+}
+
+func TestObserveStates(t *testing.T) {
+	c := &collector{}
+	a := New(Config{MaxFlows: 2}, c.emit)
+
+	a.Observe(step("", "TYPE_START", 0, 0))
+	a.Observe(step("dropped", "type_drop", 0, 0))
+	a.Observe(step("old", "TYPE_START", 0, 0))
+	a.Observe(step("recent", "TYPE_START", 0, 0))
+	a.Observe(step("old", "TYPE_START", time.Second, 0))
+	// Full: the least recently updated flow goes.
+	a.Observe(step("new", "TYPE_START", 0, 0))
+
+	want := map[string]string{"dropped": StateDropped, "recent": StateEvicted}
+	if got := c.states(); len(got) != len(want) || got["dropped"] != want["dropped"] || got["recent"] != want["recent"] {
+		t.Fatalf("emitted %v, want %v", got, want)
+	}
+
+	a.Close()
+	if got := c.states(); got["old"] != StateIncomplete || got["new"] != StateIncomplete || a.Len() != 0 {
+		t.Errorf("after Close emitted %v with %d open", got, a.Len())
+	}
+}
+
+func TestSweepEmitsIdleFlows(t *testing.T) {
+	c := &collector{}
+	a := New(Config{IdleTimeout: time.Minute}, c.emit)
+
+	a.Observe(step("idle", "TYPE_START", 0, 0))
+	time.Sleep(10 * time.Millisecond)
+	a.Observe(step("busy", "TYPE_START", 0, 0))
+	sweep := a.flows["busy"].Value.(*flow).lastSeen.Add(time.Minute - time.Millisecond)
+
+	a.Sweep(time.Now())
+	if len(c.flows) != 0 {
+		t.Fatalf("fresh flows swept: %v", c.states())
+	}
+	a.Sweep(sweep)
+	if got := c.states(); len(got) != 1 || got["idle"] != StateTimeout {
+		t.Fatalf("swept %v, want idle timed out", got)
+	}
+	if a.Len() != 1 {
+		t.Errorf("%d flows open, want 1", a.Len())
+	}
+}
+
+// Events that arrive after the end of their flow must not open a new flow
+// that later times out.
+func TestLateEventsAfterEnd(t *testing.T) {
+	c := &collector{}
+	a := New(Config{IdleTimeout: time.Minute, LateWindow: time.Minute, MaxFlows: 2}, c.emit)
+
+	a.Observe(step("f1", "TYPE_START", 0, 10))
+	a.Observe(step("f1", "TYPE_END", time.Second, 20))
+	a.Observe(step("f2", "TYPE_DROP", 0, 0))
+	ended := a.ended["f1"].Value.(*tombstone).ended
+
+	a.Observe(step("f1", "TYPE_START", 0, 10))
+	a.Observe(step("f2", "TYPE_START", 0, 0))
+	if a.Len() != 0 {
+		t.Fatalf("late events opened %d flows", a.Len())
+	}
+	a.Sweep(ended.Add(time.Hour))
+	if got := c.states(); len(c.flows) != 2 || got["f1"] != StateCompleted || got["f2"] != StateDropped {
+		t.Fatalf("emitted %v, want f1 completed and f2 dropped once", got)
+	}
+	if c.flows[0].EventCount != 2 {
+		t.Errorf("f1 has %d events, want the late one left out", c.flows[0].EventCount)
+	}
+
+	// Once the window has passed the ID is forgotten and starts a new flow.
+	if len(a.ended) != 0 {
+		t.Fatalf("%d tombstones left after the late window", len(a.ended))
+	}
+	a.Observe(step("f1", "TYPE_START", time.Hour, 10))
+	if a.Len() != 1 {
+		t.Errorf("%d flows open, want the reused ID tracked again", a.Len())
+	}
+
+	// Tombstones are bounded by MaxFlows.
+	for _, id := range []string{"a", "b", "c"} {
+		a.Observe(step(id, "TYPE_DROP", 0, 0))
+	}
+	if _, ok := a.ended["a"]; ok || len(a.ended) != 2 {
+		t.Errorf("tombstones %v, want the oldest dropped at MaxFlows", a.ended)
+	}
+}
+
+func TestConcurrentObserve(t *testing.T) {
+	c := &collector{}
+	a := New(Config{IdleTimeout: time.Hour}, c.emit)
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				id := strconv.Itoa(w) + "-" + strconv.Itoa(i)
+				a.Observe(step(id, "TYPE_START", 0, 10))
+				a.Observe(step(id, "TYPE_END", time.Second, 20))
+				if i%10 == 0 {
+					a.Sweep(time.Now())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(c.flows) != 800 || a.Len() != 0 {
+		t.Fatalf("emitted %d flows with %d open, want 800 and 0", len(c.flows), a.Len())
+	}
+	for _, f := range c.flows {
+		if f.State != StateCompleted || f.EventCount != 2 {
+			t.Fatalf("flow %s = %s with %d events", f.FlowID, f.State, f.EventCount)
+		}
+	}
+}
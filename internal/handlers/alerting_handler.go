@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/alerting"
+	"github.com/gin-gonic/gin"
+)
+
+// TestAlert sends a sample alert through the rule given by ?rule=, or lists
+// the loaded rules when no rule is given.
+func TestAlert(ginContext *gin.Context) {
+	rule := ginContext.Query("rule")
+	if rule == "" {
+		ginContext.JSON(http.StatusBadRequest, gin.H{"message": "missing ?rule=", "rules": alerting.Rules()})
+		return
+	}
+
+	if err := alerting.Test(ginContext.Request.Context(), rule); err != nil {
+		ginContext.JSON(http.StatusBadGateway, gin.H{"message": "test alert failed", "error": err.Error()})
+		return
+	}
+	ginContext.JSON(http.StatusOK, gin.H{"status": "sent", "rule": rule})
+}
@@ -3,14 +3,17 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
-	"github.com/NorskHelsenett/netbird-log-forwarder/internal/services"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/queue"
 	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
 	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
 )
 
 type messagePreview struct {
@@ -40,14 +43,7 @@ func RecieveEvent(ginContext *gin.Context) {
 			ginContext.JSON(http.StatusBadRequest, gin.H{"message": "invalid traffic payload", "error": err.Error()})
 			return
 		}
-		_, err := services.ProcessTrafficEvent(event)
-		if err != nil {
-			if err.Error() == "not_splunk_worthy" {
-				ginContext.JSON(http.StatusAccepted, gin.H{"status": "ok"})
-				return
-			}
-			ginContext.Error(err)
-			ginContext.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		if !enqueue(ginContext, queue.Job{Traffic: &event}) {
 			return
 		}
 
@@ -58,14 +54,10 @@ func RecieveEvent(ginContext *gin.Context) {
 		var event apicontracts.AuditEventEnvelope
 
 		if err := json.Unmarshal(requestBody, &event); err != nil {
-			logger.SplunkAudit.Errorw("failed to decode", "error", err)
+			ginContext.JSON(http.StatusBadRequest, gin.H{"message": "invalid audit payload", "error": err.Error()})
 			return
 		}
-		_, err = services.ProcessAuditEvent(event)
-		if err != nil {
-
-			ginContext.Error(err)
-			ginContext.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		if !enqueue(ginContext, queue.Job{Audit: &event}) {
 			return
 		}
 
@@ -75,6 +67,37 @@ func RecieveEvent(ginContext *gin.Context) {
 	}
 }
 
+var enqueueJob = func(job queue.Job) error {
+	return queue.GlobalQueue.Enqueue(job)
+}
+
+// enqueue hands the job to the worker pool. When the queue is full or shutting
+// down it answers with a Retry-After so NetBird backs off and redelivers.
+func enqueue(ginContext *gin.Context, job queue.Job) bool {
+	err := enqueueJob(job)
+	if err == nil {
+		return true
+	}
+
+	retryAfter := viper.GetDuration("queue.retry_after")
+	ginContext.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+
+	if errors.Is(err, queue.ErrClosed) {
+		logger.Log.Warnln("Ingest queue closed, rejecting event")
+		ginContext.JSON(http.StatusServiceUnavailable, gin.H{"message": "shutting down"})
+		return false
+	}
+
+	status := viper.GetInt("queue.full_status")
+	if status != http.StatusServiceUnavailable {
+		status = http.StatusTooManyRequests
+	}
+
+	logger.Log.Warnf("Ingest queue full (%d/%d), rejecting event", queue.GlobalQueue.Len(), queue.GlobalQueue.Cap())
+	ginContext.JSON(status, gin.H{"message": "ingest queue full"})
+	return false
+}
+
 func looksLikeTrafficEvent(msg string) bool {
 	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(msg)), "TYPE_")
 }
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/queue"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+func post(body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/events", RecieveEvent)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body)))
+	return w
+}
+
+// closedQueue installs a queue that has been shut down as GlobalQueue.
+func closedQueue(t *testing.T) {
+	t.Helper()
+	prev := queue.GlobalQueue
+	queue.GlobalQueue = queue.NewQueue(1, 1)
+	queue.GlobalQueue.Close()
+	t.Cleanup(func() { queue.GlobalQueue = prev })
+}
+
+func TestRecieveEventRejectsWhenQueueUnavailable(t *testing.T) {
+	viper.Set("queue.retry_after", "7s")
+	t.Cleanup(viper.Reset)
+
+	tests := []struct {
+		name       string
+		fullStatus int
+		err        error
+		wantStatus int
+	}{
+		{"full", 0, queue.ErrFull, http.StatusTooManyRequests},
+		{"full with configured 503", http.StatusServiceUnavailable, queue.ErrFull, http.StatusServiceUnavailable},
+		{"shutting down", 0, nil, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			closedQueue(t)
+			viper.Set("queue.full_status", tt.fullStatus)
+			if tt.err != nil {
+				prev := enqueueJob
+				enqueueJob = func(queue.Job) error { return tt.err }
+				t.Cleanup(func() { enqueueJob = prev })
+			}
+
+			for _, body := range []string{`{"message": "User joined"}`, `{"message": "TYPE_START"}`} {
+				w := post(body)
+				if w.Code != tt.wantStatus {
+					t.Errorf("%s: status = %d, want %d", body, w.Code, tt.wantStatus)
+				}
+				if got := w.Header().Get("Retry-After"); got != "7" {
+					t.Errorf("%s: Retry-After = %q, want 7", body, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRecieveEventAccepts(t *testing.T) {
+	var jobs []queue.Job
+	prev := enqueueJob
+	enqueueJob = func(job queue.Job) error {
+		jobs = append(jobs, job)
+		return nil
+	}
+	t.Cleanup(func() { enqueueJob = prev })
+
+	if w := post(`{"message": "User joined"}`); w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"handled_as":"audit"`) {
+		t.Errorf("audit: %d %s", w.Code, w.Body)
+	}
+	if w := post(`{"message": "TYPE_START"}`); w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"handled_as":"traffic"`) {
+		t.Errorf("traffic: %d %s", w.Code, w.Body)
+	}
+	if w := post(`{"message": "TYPE_START", "bogus": 1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown traffic field: status %d, want 400", w.Code)
+	}
+	if len(jobs) != 2 || jobs[0].Audit == nil || jobs[1].Traffic == nil {
+		t.Errorf("enqueued %+v", jobs)
+	}
+}
@@ -0,0 +1,89 @@
+// Package match holds the port and name matching shared by the filter and
+// nat rules.
+package match
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports. A single port has From == To.
+type PortRange struct {
+	From, To int
+}
+
+func (r PortRange) Contains(port int) bool {
+	return port >= r.From && port <= r.To
+}
+
+// ParsePorts parses ports ("443") and ranges ("8000-8999"). Ports must be
+// within 0-65535 and ranges must not be reversed.
+func ParsePorts(values []string) ([]PortRange, error) {
+	var ranges []PortRange
+	for _, v := range values {
+		from, to, isRange := strings.Cut(v, "-")
+		lo, err := parsePort(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", v)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = parsePort(to); err != nil || hi < lo {
+				return nil, fmt.Errorf("invalid port range %q", v)
+			}
+		}
+		ranges = append(ranges, PortRange{From: lo, To: hi})
+	}
+	return ranges, nil
+}
+
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 || p > 65535 {
+		return 0, fmt.Errorf("port %d out of range", p)
+	}
+	return p, nil
+}
+
+// Ports reports whether port is within one of the ranges. No ranges match
+// any port.
+func Ports(ranges []PortRange, port int) bool {
+	if len(ranges) == 0 {
+		return true
+	}
+	for _, r := range ranges {
+		if r.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateGlobs checks that the shell-style patterns are well formed.
+func ValidateGlobs(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// Glob reports whether v matches one of the shell-style patterns. No
+// patterns match anything.
+func Glob(patterns []string, v string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, v); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package match
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		in      []string
+		want    []PortRange
+		wantErr string
+	}{
+		{nil, nil, ""},
+		{[]string{"443"}, []PortRange{{443, 443}}, ""},
+		{[]string{"0", "65535"}, []PortRange{{0, 0}, {65535, 65535}}, ""},
+		{[]string{"8000-8999", " 49152 - 65535 "}, []PortRange{{8000, 8999}, {49152, 65535}}, ""},
+		{[]string{"80-80"}, []PortRange{{80, 80}}, ""},
+		{[]string{"https"}, nil, `invalid port "https"`},
+		{[]string{""}, nil, `invalid port ""`},
+		{[]string{"65536"}, nil, `invalid port "65536"`},
+		{[]string{"-1"}, nil, `invalid port "-1"`},
+		{[]string{"443-80"}, nil, `invalid port range "443-80"`},
+		{[]string{"1000-70000"}, nil, `invalid port range "1000-70000"`},
+		{[]string{"1000-"}, nil, `invalid port range "1000-"`},
+	}
+	for _, tt := range tests {
+		got, err := ParsePorts(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParsePorts(%q) error = %v, want %s", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("ParsePorts(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestPorts(t *testing.T) {
+	ranges := []PortRange{{443, 443}, {8000, 8999}}
+	tests := []struct {
+		ranges []PortRange
+		port   int
+		want   bool
+	}{
+		{nil, 22, true},
+		{ranges, 443, true},
+		{ranges, 8000, true},
+		{ranges, 8999, true},
+		{ranges, 9000, false},
+		{ranges, -1, false},
+	}
+	for _, tt := range tests {
+		if got := Ports(tt.ranges, tt.port); got != tt.want {
+			t.Errorf("Ports(%v, %d) = %t, want %t", tt.ranges, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		v        string
+		want     bool
+	}{
+		{nil, "anything", true},
+		{[]string{"router-*"}, "router-1", true},
+		{[]string{"router-*"}, "exit-1", false},
+		{[]string{"db-?", "web"}, "web", true},
+		{[]string{""}, "", true},
+		{[]string{""}, "x", false},
+		{[]string{"["}, "[", false},
+	}
+	for _, tt := range tests {
+		if got := Glob(tt.patterns, tt.v); got != tt.want {
+			t.Errorf("Glob(%q, %q) = %t, want %t", tt.patterns, tt.v, got, tt.want)
+		}
+	}
+
+	if err := ValidateGlobs([]string{"*.example.com", "db-[0-9]"}); err != nil {
+		t.Errorf("ValidateGlobs = %v", err)
+	}
+	if err := ValidateGlobs([]string{"ok", "["}); err == nil {
+		t.Error("ValidateGlobs accepted a malformed pattern")
+	}
+}
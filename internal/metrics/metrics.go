@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "netbird_forwarder"
+
+var (
+	CacheEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_entries",
+		Help:      "Number of entries in a NetBird lookup cache.",
+	}, []string{"cache"})
+
+	CacheStale = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_stale",
+		Help:      "1 while a cache serves data that could not be refreshed from the NetBird API.",
+	}, []string{"cache"})
+
+	CacheRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_refreshes_total",
+		Help:      "Cache refresh attempts by result (ok, error).",
+	}, []string{"cache", "result"})
+
+	CacheLastRefresh = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_last_refresh_timestamp_seconds",
+		Help:      "Unix time of the data currently held by a cache.",
+	}, []string{"cache"})
+
+	UnknownActivities = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_unknown_activities_total",
+		Help:      "Audit events whose activity is not in the activity catalog.",
+	})
+
+	FlowsActive = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "flows_active",
+		Help:      "Flows currently held by the flow aggregator.",
+	})
+
+	FlowsEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "flows_emitted_total",
+		Help:      "Flow records emitted by final state (completed, dropped, timeout, evicted, incomplete).",
+	}, []string{"state"})
+
+	FlowsEvicted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "flows_evicted_total",
+		Help:      "Open flows emitted early because the aggregator reached flows.max_flows.",
+	})
+
+	FlowsLateEvents = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "flows_late_events_total",
+		Help:      "Traffic events dropped by the flow aggregator because their flow had already ended.",
+	})
+
+	DedupEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "traffic_dedup_events_total",
+		Help:      "Traffic events seen by the de-duplication stage by result (unique, duplicate, held, replaced, released, unkeyed, overflow).",
+	}, []string{"result"})
+
+	QueueDuplicates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_duplicates_total",
+		Help:      "Events discarded by the ingest queue because they were already enqueued within pull.dedup_ttl.",
+	}, []string{"kind"})
+
+	AlertsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "alerts_dropped_total",
+		Help:      "Alerts dropped because the alert queue was full or shutting down.",
+	}, []string{"rule"})
+)
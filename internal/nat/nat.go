@@ -0,0 +1,189 @@
+package nat
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/match"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netaddr"
+	"github.com/spf13/viper"
+)
+
+// Config is the nat section of config.yaml. Rules are evaluated in order and
+// the first match gives the translated source address.
+type Config struct {
+	Rules []Rule `mapstructure:"rules"`
+}
+
+// Rule describes one source NAT. Empty lists match anything, values within a
+// list are OR'ed and the lists are AND'ed together. Exit nodes and peer
+// groups accept shell-style globs.
+type Rule struct {
+	Name             string   `mapstructure:"name"`
+	ExitNodes        []string `mapstructure:"exit_nodes"`
+	PeerGroups       []string `mapstructure:"peer_groups"`
+	DestinationCIDRs []string `mapstructure:"destination_cidrs"`
+	DestinationPorts []string `mapstructure:"destination_ports"`
+	TranslatedIP     string   `mapstructure:"translated_ip"`
+}
+
+// Flow is what the rules match on.
+type Flow struct {
+	ExitNode   string
+	PeerGroups []string
+	DstIP      netip.Addr
+	DstPort    int
+}
+
+type compiledRule struct {
+	name       string
+	exitNodes  []string
+	peerGroups []string
+	dstNets    []netip.Prefix
+	dstPorts   []match.PortRange
+	translated netip.Addr
+}
+
+type Engine struct {
+	rules []compiledRule
+}
+
+var current atomic.Pointer[Engine]
+
+// Load compiles the nat section and the legacy xlate map of the current
+// config and swaps them in. On error the previous rules stay active.
+func Load() error {
+	var cfg Config
+	if err := viper.UnmarshalKey("nat", &cfg); err != nil {
+		return fmt.Errorf("decode nat config: %w", err)
+	}
+	cfg.Rules = append(cfg.Rules, legacyRules(viper.GetStringMapString("xlate"))...)
+
+	engine, err := Compile(cfg)
+	if err != nil {
+		return err
+	}
+	current.Store(engine)
+	return nil
+}
+
+// legacyRules turns the old xlate map (exit node hostname -> address) into
+// rules that apply after the configured ones.
+func legacyRules(xlate map[string]string) []Rule {
+	hosts := make([]string, 0, len(xlate))
+	for host := range xlate {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	rules := make([]Rule, 0, len(hosts))
+	for _, host := range hosts {
+		rules = append(rules, Rule{
+			Name:         "xlate:" + host,
+			ExitNodes:    []string{host},
+			TranslatedIP: xlate[host],
+		})
+	}
+	return rules
+}
+
+func Compile(cfg Config) (*Engine, error) {
+	engine := &Engine{}
+	for i, rule := range cfg.Rules {
+		name := rule.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		compiled, err := compileRule(name, rule)
+		if err != nil {
+			return nil, fmt.Errorf("nat rule %s: %w", name, err)
+		}
+		engine.rules = append(engine.rules, compiled)
+	}
+	return engine, nil
+}
+
+func compileRule(name string, rule Rule) (compiledRule, error) {
+	c := compiledRule{
+		name:       name,
+		exitNodes:  rule.ExitNodes,
+		peerGroups: rule.PeerGroups,
+	}
+
+	translated, err := netip.ParseAddr(rule.TranslatedIP)
+	if err != nil {
+		return c, fmt.Errorf("translated_ip: %w", err)
+	}
+	c.translated = translated.Unmap()
+
+	for _, v := range rule.DestinationCIDRs {
+		network, err := netaddr.ParsePrefix(v)
+		if err != nil {
+			return c, fmt.Errorf("destination_cidrs: %w", err)
+		}
+		c.dstNets = append(c.dstNets, network)
+	}
+
+	if c.dstPorts, err = match.ParsePorts(rule.DestinationPorts); err != nil {
+		return c, fmt.Errorf("destination_ports: %w", err)
+	}
+	for _, patterns := range [][]string{rule.ExitNodes, rule.PeerGroups} {
+		if err := match.ValidateGlobs(patterns); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// Translate returns the translated source address for the flow and the name
+// of the rule that produced it.
+func Translate(f Flow) (netip.Addr, string, bool) {
+	engine := current.Load()
+	if engine == nil {
+		return netip.Addr{}, "", false
+	}
+	return engine.Translate(f)
+}
+
+func (e *Engine) Translate(f Flow) (netip.Addr, string, bool) {
+	for _, rule := range e.rules {
+		if rule.matches(f) {
+			return rule.translated, rule.name, true
+		}
+	}
+	return netip.Addr{}, "", false
+}
+
+func (r compiledRule) matches(f Flow) bool {
+	if !match.Glob(r.exitNodes, f.ExitNode) {
+		return false
+	}
+	if len(r.peerGroups) > 0 {
+		found := false
+		for _, g := range f.PeerGroups {
+			if match.Glob(r.peerGroups, g) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.dstNets) > 0 {
+		found := false
+		for _, n := range r.dstNets {
+			if netaddr.Contains(n, f.DstIP) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return match.Ports(r.dstPorts, f.DstPort)
+}
@@ -0,0 +1,120 @@
+package nat
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTranslate(t *testing.T) {
+	engine, err := Compile(Config{Rules: []Rule{
+		{Name: "dc-https", ExitNodes: []string{"router-*"}, DestinationCIDRs: []string{"10.0.0.0/8"}, DestinationPorts: []string{"443", "8000-8999"}, TranslatedIP: "192.0.2.10"},
+		{Name: "developers", PeerGroups: []string{"dev*"}, TranslatedIP: "::ffff:192.0.2.20"},
+		{ExitNodes: []string{"router-2"}, TranslatedIP: "2001:db8::1"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		flow     Flow
+		wantIP   string // empty for no translation
+		wantRule string
+	}{
+		{"all conditions", Flow{ExitNode: "router-1", DstIP: netip.MustParseAddr("10.1.2.3"), DstPort: 443}, "192.0.2.10", "dc-https"},
+		{"port range", Flow{ExitNode: "router-1", DstIP: netip.MustParseAddr("10.1.2.3"), DstPort: 8080}, "192.0.2.10", "dc-https"},
+		{"port outside", Flow{ExitNode: "router-1", DstIP: netip.MustParseAddr("10.1.2.3"), DstPort: 22}, "", ""},
+		{"any group matches", Flow{PeerGroups: []string{"ops", "developers"}}, "192.0.2.20", "developers"},
+		{"later rule", Flow{ExitNode: "router-2", DstIP: netip.MustParseAddr("172.16.0.1"), DstPort: 443}, "2001:db8::1", "#3"},
+		{"no exit node", Flow{DstIP: netip.MustParseAddr("10.1.2.3"), DstPort: 443}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, rule, ok := engine.Translate(tt.flow)
+			if tt.wantIP == "" {
+				if ok {
+					t.Errorf("translated to %s by %s, want no translation", ip, rule)
+				}
+				return
+			}
+			if !ok || ip != netip.MustParseAddr(tt.wantIP) || rule != tt.wantRule {
+				t.Errorf("Translate = %s by %q, %t; want %s by %q", ip, rule, ok, tt.wantIP, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestCompileRejectsBadRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr string
+	}{
+		{"no translated ip", Rule{}, "translated_ip"},
+		{"bad cidr", Rule{TranslatedIP: "192.0.2.1", DestinationCIDRs: []string{"10.0.0.0/40"}}, "destination_cidrs"},
+		{"bad port", Rule{TranslatedIP: "192.0.2.1", DestinationPorts: []string{"https"}}, "invalid port"},
+		{"reversed range", Rule{TranslatedIP: "192.0.2.1", DestinationPorts: []string{"9000-8000"}}, "invalid port range"},
+		{"port out of range", Rule{TranslatedIP: "192.0.2.1", DestinationPorts: []string{"1-70000"}}, "invalid port range"},
+		{"bad pattern", Rule{TranslatedIP: "192.0.2.1", PeerGroups: []string{"["}}, "invalid pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(Config{Rules: []Rule{tt.rule}})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// The old xlate map still works and applies after the nat rules.
+func TestLoadAppendsLegacyXlate(t *testing.T) {
+	t.Cleanup(func() {
+		viper.Set("nat", nil)
+		viper.Set("xlate", nil)
+		current.Store(nil)
+	})
+	viper.Set("nat", map[string]any{"rules": []map[string]any{
+		{"name": "office", "exit_nodes": []string{"router-1"}, "peer_groups": []string{"office"}, "translated_ip": "192.0.2.1"},
+	}})
+	viper.Set("xlate", map[string]string{"router-1": "192.0.2.2", "router-0": "192.0.2.3"})
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		flow     Flow
+		wantIP   string
+		wantRule string
+	}{
+		{Flow{ExitNode: "router-1", PeerGroups: []string{"office"}}, "192.0.2.1", "office"},
+		{Flow{ExitNode: "router-1"}, "192.0.2.2", "xlate:router-1"},
+		{Flow{ExitNode: "router-0"}, "192.0.2.3", "xlate:router-0"},
+	}
+	for _, tt := range tests {
+		ip, rule, ok := Translate(tt.flow)
+		if !ok || ip != netip.MustParseAddr(tt.wantIP) || rule != tt.wantRule {
+			t.Errorf("Translate(%+v) = %s by %q, %t; want %s by %q", tt.flow, ip, rule, ok, tt.wantIP, tt.wantRule)
+		}
+	}
+
+	// A broken config keeps the rules that were loaded before.
+	viper.Set("xlate", map[string]string{"router-1": "not-an-ip"})
+	if err := Load(); err == nil {
+		t.Fatal("Load accepted a bad xlate address")
+	}
+	if _, rule, _ := Translate(Flow{ExitNode: "router-0"}); rule != "xlate:router-0" {
+		t.Errorf("previous rules replaced after a failed load, got %q", rule)
+	}
+
+	viper.Set("xlate", nil)
+	viper.Set("nat", map[string]any{"rules": []map[string]any{
+		{"name": "web", "destination_ports": []string{"99999"}, "translated_ip": "192.0.2.1"},
+	}})
+	if err := Load(); err == nil || !strings.Contains(err.Error(), "destination_ports") {
+		t.Errorf("Load error = %v, want the out of range port rejected", err)
+	}
+}
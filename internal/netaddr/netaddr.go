@@ -0,0 +1,72 @@
+package netaddr
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Split parses the addresses NetBird reports: "10.0.0.1:443",
+// "[fd00::1]:443", "[fe80::1%eth0]:443" as well as bare addresses without a
+// port. IPv4-mapped IPv6 addresses are unmapped. The address is invalid when
+// the host is not an IP, and the port is -1 when missing.
+func Split(s string) (netip.Addr, int) {
+	s = strings.TrimSpace(s)
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), int(ap.Port())
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")); err == nil {
+		return addr.Unmap(), -1
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return netip.Addr{}, -1
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 0 || p > 65535 {
+		p = -1
+	}
+	addr, _ := netip.ParseAddr(host)
+	return addr.Unmap(), p
+}
+
+// Host returns the host part of s, without brackets or port. It is the
+// address when s holds an IP and the raw host otherwise.
+func Host(s string) string {
+	if addr, _ := Split(s); addr.IsValid() {
+		return addr.String()
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return s
+}
+
+// ParsePrefix parses a CIDR, or a single address as a host prefix, and
+// returns it masked.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p.Masked(), nil
+}
+
+// Contains reports whether addr is in prefix. Zones are ignored, unlike
+// netip.Prefix.Contains which never matches a zoned address.
+func Contains(prefix netip.Prefix, addr netip.Addr) bool {
+	return addr.IsValid() && prefix.Contains(addr.WithZone(""))
+}
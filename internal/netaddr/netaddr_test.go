@@ -0,0 +1,126 @@
+package netaddr
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		in       string
+		wantAddr string // empty for an invalid address
+		wantPort int
+	}{
+		{"10.0.0.1:443", "10.0.0.1", 443},
+		{"10.0.0.1", "10.0.0.1", -1},
+		{" 10.0.0.1:22 ", "10.0.0.1", 22},
+		{"[fd00::1]:443", "fd00::1", 443},
+		{"fd00::1", "fd00::1", -1},
+		{"[fd00::1]", "fd00::1", -1},
+		{"[fe80::1%eth0]:443", "fe80::1%eth0", 443},
+		{"fe80::1%eth0", "fe80::1%eth0", -1},
+		{"[fe80::1%eth0]", "fe80::1%eth0", -1},
+		{"[::ffff:10.0.0.1]:80", "10.0.0.1", 80},
+		{"::ffff:10.0.0.1", "10.0.0.1", -1},
+		{"10.0.0.1:", "10.0.0.1", -1},
+		{"10.0.0.1:http", "10.0.0.1", -1},
+		{"10.0.0.1:70000", "10.0.0.1", -1},
+		{"host.example.com:443", "", 443},
+		{"host.example.com", "", -1},
+		{"", "", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			addr, port := Split(tt.in)
+			if tt.wantAddr == "" {
+				if addr.IsValid() {
+					t.Errorf("addr = %s, want invalid", addr)
+				}
+			} else if addr != netip.MustParseAddr(tt.wantAddr) {
+				t.Errorf("addr = %s, want %s", addr, tt.wantAddr)
+			}
+			if port != tt.wantPort {
+				t.Errorf("port = %d, want %d", port, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"10.0.0.1:443", "10.0.0.1"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"[fd00::1]:443", "fd00::1"},
+		{"[fd00::1]", "fd00::1"},
+		{"fd00::1", "fd00::1"},
+		{"[fe80::1%eth0]:443", "fe80::1%eth0"},
+		{"[::ffff:10.0.0.1]:80", "10.0.0.1"},
+		{"host.example.com:443", "host.example.com"},
+		{"host.example.com", "host.example.com"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := Host(tt.in); got != tt.want {
+				t.Errorf("Host(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", false},
+		{"10.1.2.3/8", "10.0.0.0/8", false},
+		{" 192.168.1.0/24 ", "192.168.1.0/24", false},
+		{"10.0.0.5", "10.0.0.5/32", false},
+		{"fd00::/8", "fd00::/8", false},
+		{"fd00::1234/64", "fd00::/64", false},
+		{"fd00::1", "fd00::1/128", false},
+		{"::ffff:10.0.0.0/104", "10.0.0.0/8", false},
+		{"::ffff:10.0.0.1", "10.0.0.1/32", false},
+		{"10.0.0.0/33", "", true},
+		{"fd00::/129", "", true},
+		{"fe80::1%eth0/64", "", true},
+		{"10.0.0.0/", "", true},
+		{"not-a-network", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePrefix(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParsePrefix(%q) = %s, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePrefix(%q): %v", tt.in, err)
+			}
+			if got != netip.MustParsePrefix(tt.want) {
+				t.Errorf("ParsePrefix(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	prefix := netip.MustParsePrefix("fe80::/10")
+	if !Contains(prefix, netip.MustParseAddr("fe80::1%eth0")) {
+		t.Error("zoned address not contained")
+	}
+	if Contains(prefix, netip.Addr{}) {
+		t.Error("invalid address contained")
+	}
+	if Contains(netip.MustParsePrefix("10.0.0.0/8"), netip.MustParseAddr("192.0.2.1")) {
+		t.Error("address outside prefix contained")
+	}
+}
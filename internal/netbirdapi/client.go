@@ -0,0 +1,243 @@
+package netbirdapi
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/viper"
+)
+
+const DefaultBaseURL = "https://api.netbird.io"
+
+var GlobalClient *Client
+
+type Config struct {
+	// BaseURL of the management API, e.g. https://netbird.example.com for a
+	// self-hosted deployment. Defaults to the NetBird cloud.
+	BaseURL string
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile             string
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+}
+
+// Client talks to the NetBird management API. It is shared by the caches,
+// the poller and the backfill command.
+type Client struct {
+	baseURL string
+	token   string
+	http    *resty.Client
+}
+
+func NewClient(token string, cfg Config) (*Client, error) {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify} // #nosec G402 -- opt-in for lab setups
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(cfg.BaseURL, "/"),
+		token:   token,
+		http: resty.New().
+			SetTimeout(cfg.Timeout).
+			SetTLSClientConfig(tlsConfig).
+			SetHeader("Accept", "application/json").
+			SetHeader("Authorization", "Token "+token),
+	}, nil
+}
+
+// InitClient builds GlobalClient from the netbird.* config.
+func InitClient(token string) error {
+	c, err := NewClient(token, Config{
+		BaseURL:            viper.GetString("netbird.api_url"),
+		CAFile:             viper.GetString("netbird.tls.ca_file"),
+		InsecureSkipVerify: viper.GetBool("netbird.tls.insecure_skip_verify"),
+		Timeout:            viper.GetDuration("netbird.timeout"),
+	})
+	if err != nil {
+		return err
+	}
+	GlobalClient = c
+	return nil
+}
+
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+func (c *Client) get(ctx context.Context, path string, query map[string]string, result any) error {
+	resp, err := c.http.R().
+		SetContext(ctx).
+		SetQueryParams(query).
+		SetResult(result).
+		Get(c.baseURL + path)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	if resp.IsError() {
+		return fmt.Errorf("error response: %s", resp.Status())
+	}
+	return nil
+}
+
+func (c *Client) ListPeers(ctx context.Context) ([]netbird.NetbirdPeer, error) {
+	var peers []netbird.NetbirdPeer
+	if err := c.get(ctx, "/api/peers", nil, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+func (c *Client) ListUsers(ctx context.Context) ([]netbird.NetbirdUser, error) {
+	var users []netbird.NetbirdUser
+	if err := c.get(ctx, "/api/users", nil, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (c *Client) ListGroups(ctx context.Context) ([]netbird.NetbirdGroup, error) {
+	var groups []netbird.NetbirdGroup
+	if err := c.get(ctx, "/api/groups", nil, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (c *Client) ListPolicies(ctx context.Context) ([]netbird.NetbirdPolicy, error) {
+	var policies []netbird.NetbirdPolicy
+	if err := c.get(ctx, "/api/policies", nil, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (c *Client) ListRoutes(ctx context.Context) ([]netbird.NetbirdRoute, error) {
+	var routes []netbird.NetbirdRoute
+	if err := c.get(ctx, "/api/routes", nil, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+func (c *Client) ListNameserverGroups(ctx context.Context) ([]netbird.NetbirdNameserverGroup, error) {
+	var groups []netbird.NetbirdNameserverGroup
+	if err := c.get(ctx, "/api/dns/nameservers", nil, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (c *Client) ListPostureChecks(ctx context.Context) ([]netbird.NetbirdPostureCheck, error) {
+	var checks []netbird.NetbirdPostureCheck
+	if err := c.get(ctx, "/api/posture-checks", nil, &checks); err != nil {
+		return nil, err
+	}
+	return checks, nil
+}
+
+func (c *Client) ListSetupKeys(ctx context.Context) ([]netbird.NetbirdSetupKey, error) {
+	var keys []netbird.NetbirdSetupKey
+	if err := c.get(ctx, "/api/setup-keys", nil, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (c *Client) ListNetworks(ctx context.Context) ([]netbird.NetbirdNetwork, error) {
+	var networks []netbird.NetbirdNetwork
+	if err := c.get(ctx, "/api/networks", nil, &networks); err != nil {
+		return nil, err
+	}
+	return networks, nil
+}
+
+func (c *Client) ListNetworkResources(ctx context.Context, networkID string) ([]netbird.NetbirdNetworkResource, error) {
+	var resources []netbird.NetbirdNetworkResource
+	if err := c.get(ctx, "/api/networks/"+url.PathEscape(networkID)+"/resources", nil, &resources); err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// ListAllNetworkResources returns the resources of every network, with
+// NetworkID and NetworkName filled in.
+func (c *Client) ListAllNetworkResources(ctx context.Context) ([]netbird.NetbirdNetworkResource, error) {
+	networks, err := c.ListNetworks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var all []netbird.NetbirdNetworkResource
+	for _, network := range networks {
+		resources, err := c.ListNetworkResources(ctx, network.ID)
+		if err != nil {
+			return nil, fmt.Errorf("network %s: %w", network.ID, err)
+		}
+		for _, resource := range resources {
+			resource.NetworkID = network.ID
+			resource.NetworkName = network.Name
+			all = append(all, resource)
+		}
+	}
+	return all, nil
+}
+
+func (c *Client) ListAuditEvents(ctx context.Context) ([]netbird.NetbirdAuditEvent, error) {
+	var events []netbird.NetbirdAuditEvent
+	if err := c.get(ctx, "/api/events/audit", nil, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// ListTrafficEvents pages through /api/events/network-traffic for the given
+// window, starting at startPage, and hands each page to fn.
+func (c *Client) ListTrafficEvents(ctx context.Context, from, to time.Time, pageSize, startPage int, fn func(netbird.NetbirdTrafficPage) error) error {
+	for page := max(startPage, 1); ; page++ {
+		var result netbird.NetbirdTrafficPage
+		err := c.get(ctx, "/api/events/network-traffic", map[string]string{
+			"page":       strconv.Itoa(page),
+			"page_size":  strconv.Itoa(pageSize),
+			"start_date": from.UTC().Format(time.RFC3339),
+			"end_date":   to.UTC().Format(time.RFC3339),
+		}, &result)
+		if err != nil {
+			return err
+		}
+
+		result.Page = page
+		if err := fn(result); err != nil {
+			return err
+		}
+		if len(result.Data) == 0 || page >= result.TotalPages {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package netbirdapi
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+func reply(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newClient(t *testing.T, handler http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c, err := NewClient("secret", Config{BaseURL: srv.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestGetSendsTokenAndReportsErrors(t *testing.T) {
+	c := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/api/users" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		reply(w, []netbird.NetbirdPeer{{ID: "peer-1"}})
+	}))
+
+	peers, err := c.ListPeers(context.Background())
+	if err != nil || len(peers) != 1 || peers[0].ID != "peer-1" {
+		t.Fatalf("ListPeers = %+v, %v", peers, err)
+	}
+	if _, err := c.ListUsers(context.Background()); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("ListUsers error = %v, want the 500 status", err)
+	}
+}
+
+func TestListTrafficEventsPages(t *testing.T) {
+	var requested []string
+	c := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		requested = append(requested, q.Get("page"))
+		if q.Get("page_size") != "2" || q.Get("start_date") != "2026-01-01T00:00:00Z" || q.Get("end_date") != "2026-01-01T01:00:00Z" {
+			t.Errorf("query = %v", q)
+		}
+		page, _ := strconv.Atoi(q.Get("page"))
+		result := netbird.NetbirdTrafficPage{TotalPages: 4}
+		if page <= 3 {
+			result.Data = []netbird.NetbirdTrafficFlow{{FlowID: "flow-" + q.Get("page")}}
+		}
+		reply(w, result)
+	}))
+
+	from := time.Date(2026, 1, 1, 1, 0, 0, 0, time.FixedZone("CET", 3600))
+	var flows []string
+	err := c.ListTrafficEvents(context.Background(), from, from.Add(time.Hour), 2, 2, func(page netbird.NetbirdTrafficPage) error {
+		for _, f := range page.Data {
+			flows = append(flows, f.FlowID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Starts at the requested page and stops at the first empty page.
+	if strings.Join(requested, ",") != "2,3,4" || strings.Join(flows, ",") != "flow-2,flow-3" {
+		t.Errorf("requested pages %v and got flows %v", requested, flows)
+	}
+
+	stop := errors.New("stop")
+	requested = nil
+	err = c.ListTrafficEvents(context.Background(), from, from.Add(time.Hour), 2, 0, func(netbird.NetbirdTrafficPage) error { return stop })
+	if !errors.Is(err, stop) || strings.Join(requested, ",") != "1" {
+		t.Errorf("error = %v after pages %v, want stop after page 1", err, requested)
+	}
+}
+
+func TestListAllNetworkResources(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/networks", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, []netbird.NetbirdNetwork{{ID: "net-1", Name: "prod"}, {ID: "net 2", Name: "lab"}})
+	})
+	mux.HandleFunc("/api/networks/{id}/resources", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("id") {
+		case "net-1":
+			reply(w, []netbird.NetbirdNetworkResource{{ID: "res-1"}, {ID: "res-2"}})
+		case "net 2":
+			reply(w, []netbird.NetbirdNetworkResource{{ID: "res-3"}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	c := newClient(t, mux)
+
+	resources, err := c.ListAllNetworkResources(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"res-1": "prod", "res-2": "prod", "res-3": "lab"}
+	if len(resources) != len(want) {
+		t.Fatalf("got %d resources, want %d", len(resources), len(want))
+	}
+	for _, r := range resources {
+		if r.NetworkName != want[r.ID] || r.NetworkID == "" {
+			t.Errorf("resource %s in network %q (%s), want %q", r.ID, r.NetworkName, r.NetworkID, want[r.ID])
+		}
+	}
+}
+
+func TestNewClientCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply(w, []netbird.NetbirdGroup{})
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	untrusted, err := NewClient("secret", Config{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untrusted.ListGroups(context.Background()); err == nil {
+		t.Error("self-signed server trusted without CA file")
+	}
+
+	trusted, err := NewClient("secret", Config{BaseURL: srv.URL, CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trusted.ListGroups(context.Background()); err != nil {
+		t.Errorf("ListGroups with CA file: %v", err)
+	}
+
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, []byte("no certificates here"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewClient("secret", Config{CAFile: empty}); err == nil {
+		t.Error("CA file without certificates accepted")
+	}
+	if _, err := NewClient("secret", Config{CAFile: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Error("missing CA file accepted")
+	}
+}
+
+func TestNewClientDefaults(t *testing.T) {
+	c, err := NewClient("secret", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.BaseURL() != DefaultBaseURL {
+		t.Errorf("BaseURL = %q, want %q", c.BaseURL(), DefaultBaseURL)
+	}
+}
@@ -0,0 +1,321 @@
+package poller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/queue"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+type Config struct {
+	Interval  time.Duration
+	StateFile string
+	PageSize  int
+	// Lookback is how far back the first poll reaches when there is no
+	// checkpoint yet.
+	Lookback time.Duration
+	// Overlap re-reads the tail of the previous traffic window, since flow
+	// events can show up in the API some time after they happened. The queue
+	// de-duplicates whenever polling is enabled, so events read again are
+	// dropped as long as pull.dedup_ttl is longer than the overlap.
+	Overlap time.Duration
+}
+
+// enqueue hands a job to the ingest queue, replaced in tests.
+var enqueue = func(ctx context.Context, job queue.Job) error {
+	return queue.GlobalQueue.EnqueueWait(ctx, job)
+}
+
+// Poller reads audit and traffic events from the NetBird management API and
+// feeds them into the ingest queue, so events are not lost while the webhook
+// endpoint is unavailable.
+type Poller struct {
+	cfg    Config
+	client *netbirdapi.Client
+	state  *State
+}
+
+func NewPoller(client *netbirdapi.Client, cfg Config) (*Poller, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = 500
+	}
+	if cfg.Lookback <= 0 {
+		cfg.Lookback = time.Hour
+	}
+	if cfg.Overlap <= 0 {
+		cfg.Overlap = 5 * time.Minute
+	}
+
+	state, err := LoadState(cfg.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Poller{
+		cfg:    cfg,
+		client: client,
+		state:  state,
+	}, nil
+}
+
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.pollAudit(ctx); err != nil {
+			logger.Log.Warnf("Audit event poll failed: %v", err)
+		}
+		if err := p.pollTraffic(ctx); err != nil {
+			logger.Log.Warnf("Traffic event poll failed: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Poller) pollAudit(ctx context.Context) error {
+	events, err := p.client.ListAuditEvents(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return auditSeq(events[i]) < auditSeq(events[j])
+	})
+
+	// Without a checkpoint only the last Lookback of the audit log is read.
+	var since time.Time
+	if p.state.AuditLastID == 0 {
+		since = time.Now().Add(-p.cfg.Lookback)
+	}
+
+	var d delivery
+	var seqs []int64
+	var results []*error
+	var pollErr error
+	for _, ev := range events {
+		seq := auditSeq(ev)
+		if seq <= p.state.AuditLastID || ev.Timestamp.Before(since) {
+			continue
+		}
+		envelope, err := AuditEnvelope(ev)
+		if err != nil {
+			// Can never succeed, so it does not hold the checkpoint back.
+			logger.Log.Warnf("Skipping audit event %s: %v", ev.ID, err)
+			seqs, results = append(seqs, seq), append(results, new(error))
+			continue
+		}
+		job, result := d.track(queue.Job{Audit: &envelope})
+		if pollErr = enqueue(ctx, job); pollErr != nil {
+			job.Done(pollErr)
+			break
+		}
+		seqs, results = append(seqs, seq), append(results, result)
+	}
+	if err := d.wait(ctx); err != nil {
+		return err
+	}
+
+	// The checkpoint stops before the first event that was not delivered, so
+	// the next poll retries it.
+	sent := 0
+	for i, seq := range seqs {
+		if *results[i] != nil {
+			pollErr = errors.Join(pollErr, fmt.Errorf("audit event %d: %w", seq, *results[i]))
+			break
+		}
+		p.state.AuditLastID = seq
+		sent++
+	}
+
+	if sent > 0 {
+		logger.Log.Infof("Polled %d new audit events", sent)
+		if err := p.state.Save(); err != nil {
+			return errors.Join(pollErr, err)
+		}
+	}
+	return pollErr
+}
+
+func (p *Poller) pollTraffic(ctx context.Context) error {
+	now := time.Now().UTC()
+	from := p.state.TrafficLastTimestamp.Add(-p.cfg.Overlap)
+	if p.state.TrafficLastTimestamp.IsZero() {
+		from = now.Add(-p.cfg.Lookback)
+	}
+
+	var d delivery
+	var results []*error
+	err := p.client.ListTrafficEvents(ctx, from, now, p.cfg.PageSize, 1, func(page netbird.NetbirdTrafficPage) error {
+		for _, flow := range page.Data {
+			for _, ev := range TrafficEvents(flow) {
+				job, result := d.track(queue.Job{Traffic: &ev})
+				if err := enqueue(ctx, job); err != nil {
+					job.Done(err)
+					return err
+				}
+				results = append(results, result)
+			}
+		}
+		return nil
+	})
+	if waitErr := d.wait(ctx); waitErr != nil {
+		return errors.Join(err, waitErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Flow events are not ordered by time, so the window only counts as read
+	// once every event in it was delivered. Until then the next poll reads it
+	// again and the queue drops the events that already went through.
+	for _, result := range results {
+		if *result != nil {
+			return fmt.Errorf("traffic event: %w", *result)
+		}
+	}
+
+	if len(results) > 0 {
+		logger.Log.Infof("Polled %d traffic events", len(results))
+	}
+	p.state.TrafficLastTimestamp = now
+	return p.state.Save()
+}
+
+// delivery waits for the jobs of one poll to be processed, so the checkpoint
+// only moves past events that made it through the pipeline.
+type delivery struct {
+	wg sync.WaitGroup
+}
+
+// track sets job.Done to record the outcome in the returned error.
+func (d *delivery) track(job queue.Job) (queue.Job, *error) {
+	result := new(error)
+	d.wg.Add(1)
+	job.Done = func(err error) {
+		*result = err
+		d.wg.Done()
+	}
+	return job, result
+}
+
+func (d *delivery) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// auditSeq orders audit events. NetBird audit IDs are increasing integers
+// serialised as strings.
+func auditSeq(ev netbird.NetbirdAuditEvent) int64 {
+	n, _ := strconv.ParseInt(ev.ID, 10, 64)
+	return n
+}
+
+// AuditEnvelope converts an API audit event into the webhook representation
+// so it goes through the same decoding as pushed events.
+func AuditEnvelope(ev netbird.NetbirdAuditEvent) (apicontracts.AuditEventEnvelope, error) {
+	var envelope apicontracts.AuditEventEnvelope
+
+	id, err := strconv.Atoi(ev.ID)
+	if err != nil {
+		return envelope, fmt.Errorf("invalid id %q", ev.ID)
+	}
+	raw, err := json.Marshal(map[string]any{
+		"ID":              id,
+		"Timestamp":       ev.Timestamp.Format(time.RFC3339Nano),
+		"Message":         ev.Activity,
+		"InitiatorID":     ev.InitiatorID,
+		"target_id":       ev.TargetID,
+		"meta":            ev.Meta,
+		"activity_code":   ev.ActivityCode,
+		"initiator_name":  ev.InitiatorName,
+		"initiator_email": ev.InitiatorEmail,
+	})
+	if err != nil {
+		return envelope, err
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return envelope, err
+	}
+	envelope.ID = id
+	return envelope, nil
+}
+
+// TrafficEvents expands one API flow record into a webhook-style event per
+// flow step (start, end, drop).
+func TrafficEvents(flow netbird.NetbirdTrafficFlow) []apicontracts.TrafficEvent {
+	meta := apicontracts.TrafficMeta{
+		DestinationAddr:       flow.Destination.Address,
+		DestinationDNSLabel:   flow.Destination.DNSLabel,
+		DestinationGeoCity:    flow.Destination.GeoLocation.CityName,
+		DestinationGeoCountry: flow.Destination.GeoLocation.CountryCode,
+		DestinationID:         flow.Destination.ID,
+		DestinationName:       flow.Destination.Name,
+		DestinationType:       flow.Destination.Type,
+		Direction:             flow.Direction,
+		FlowID:                flow.FlowID,
+		ICMPCode:              flow.ICMP.Code,
+		ICMPType:              flow.ICMP.Type,
+		PolicyID:              flow.Policy.ID,
+		PolicyName:            flow.Policy.Name,
+		Protocol:              flow.Protocol,
+		ReporterID:            flow.ReporterID,
+		RxBytes:               flow.RxBytes,
+		RxPackets:             flow.RxPackets,
+		SourceAddr:            flow.Source.Address,
+		SourceDNSLabel:        flow.Source.DNSLabel,
+		SourceGeoCity:         flow.Source.GeoLocation.CityName,
+		SourceGeoCountry:      flow.Source.GeoLocation.CountryCode,
+		SourceID:              flow.Source.ID,
+		SourceName:            flow.Source.Name,
+		SourceType:            flow.Source.Type,
+		TxBytes:               flow.TxBytes,
+		TxPackets:             flow.TxPackets,
+		UserID:                flow.User.ID,
+	}
+
+	events := make([]apicontracts.TrafficEvent, 0, len(flow.Events))
+	for _, step := range flow.Events {
+		id := step.ID
+		if id == "" {
+			id = flow.FlowID + ":" + step.Type
+		}
+		m := meta
+		m.ReceivedTimestamp = step.Timestamp.UTC().Format(time.RFC3339Nano)
+		events = append(events, apicontracts.TrafficEvent{
+			ID:          id,
+			InitiatorID: flow.ReporterID,
+			Message:     step.Type,
+			Meta:        m,
+			Timestamp:   step.Timestamp,
+		})
+	}
+	return events
+}
@@ -0,0 +1,328 @@
+package poller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/queue"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+)
+
+var stamp = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeAPI serves the audit events set by the test and one traffic flow, and
+// records the start_date of each traffic request.
+type fakeAPI struct {
+	mu         sync.Mutex
+	audit      []netbird.NetbirdAuditEvent
+	startDates []time.Time
+}
+
+func (f *fakeAPI) setAudit(ids ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.audit = nil
+	for _, id := range ids {
+		f.audit = append(f.audit, netbird.NetbirdAuditEvent{ID: id, Timestamp: time.Now(), Activity: "User joined"})
+	}
+}
+
+func (f *fakeAPI) client(t *testing.T) *netbirdapi.Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/events/audit", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(f.audit)
+	})
+	mux.HandleFunc("/api/events/network-traffic", func(w http.ResponseWriter, r *http.Request) {
+		start, _ := time.Parse(time.RFC3339, r.URL.Query().Get("start_date"))
+		f.mu.Lock()
+		f.startDates = append(f.startDates, start)
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(netbird.NetbirdTrafficPage{TotalPages: 1, Data: []netbird.NetbirdTrafficFlow{{
+			FlowID: "flow-1",
+			Events: []netbird.NetbirdTrafficFlowStep{{Type: "TYPE_START", Timestamp: stamp}},
+		}}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	client, err := netbirdapi.NewClient("token", netbirdapi.Config{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+var errSinkDown = errors.New("sink down")
+
+// stubQueue records the IDs of enqueued jobs. Jobs listed with
+// queue.ErrClosed are refused, other listed errors are reported as the
+// outcome of processing.
+func stubQueue(t *testing.T, fail map[string]error) *[]string {
+	t.Helper()
+	var ids []string
+	prev := enqueue
+	enqueue = func(_ context.Context, job queue.Job) error {
+		id := ""
+		if job.Audit != nil {
+			id = strconv.Itoa(job.Audit.ID)
+		} else {
+			id = job.Traffic.ID
+		}
+		if errors.Is(fail[id], queue.ErrClosed) {
+			return fail[id]
+		}
+		ids = append(ids, id)
+		go job.Done(fail[id])
+		return nil
+	}
+	t.Cleanup(func() { enqueue = prev })
+	return &ids
+}
+
+func checkpoint(t *testing.T, path string) *State {
+	t.Helper()
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestPollAuditContinuesAfterLastQueued(t *testing.T) {
+	api := &fakeAPI{}
+	api.setAudit("3", "1", "2")
+	client := api.client(t)
+	cfg := Config{StateFile: filepath.Join(t.TempDir(), "state.json")}
+
+	sent := stubQueue(t, map[string]error{"3": queue.ErrClosed})
+	p, err := NewPoller(client, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.pollAudit(context.Background()); err == nil {
+		t.Fatal("pollAudit succeeded although the queue failed")
+	}
+	if want := []string{"1", "2"}; !slices.Equal(*sent, want) {
+		t.Fatalf("sent %v, want %v", *sent, want)
+	}
+	if state := checkpoint(t, cfg.StateFile); state.AuditLastID != 2 {
+		t.Fatalf("checkpoint after failed poll = %d, want 2", state.AuditLastID)
+	}
+
+	// The next poll continues after the last event that was queued.
+	api.setAudit("1", "2", "3", "4")
+	sent = stubQueue(t, nil)
+	if err := p.pollAudit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"3", "4"}; !slices.Equal(*sent, want) {
+		t.Fatalf("resumed poll sent %v, want %v", *sent, want)
+	}
+	if state := checkpoint(t, cfg.StateFile); state.AuditLastID != 4 {
+		t.Errorf("checkpoint = %d, want 4", state.AuditLastID)
+	}
+
+	// A restarted poller reads the checkpoint and has nothing new to send.
+	sent = stubQueue(t, nil)
+	if p, err = NewPoller(client, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.pollAudit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 0 {
+		t.Errorf("restarted poller sent %v again", *sent)
+	}
+}
+
+func TestPollAuditCheckpointsDelivered(t *testing.T) {
+	api := &fakeAPI{}
+	api.setAudit("1", "2", "3")
+	cfg := Config{StateFile: filepath.Join(t.TempDir(), "state.json")}
+	p, err := NewPoller(api.client(t), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := stubQueue(t, map[string]error{"2": errSinkDown})
+	if err := p.pollAudit(context.Background()); !errors.Is(err, errSinkDown) {
+		t.Fatalf("pollAudit = %v, want the delivery error", err)
+	}
+	if want := []string{"1", "2", "3"}; !slices.Equal(*sent, want) {
+		t.Fatalf("sent %v, want %v", *sent, want)
+	}
+	if state := checkpoint(t, cfg.StateFile); state.AuditLastID != 1 {
+		t.Fatalf("checkpoint = %d, want 1", state.AuditLastID)
+	}
+
+	sent = stubQueue(t, nil)
+	if err := p.pollAudit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2", "3"}; !slices.Equal(*sent, want) {
+		t.Errorf("retry sent %v, want %v", *sent, want)
+	}
+}
+
+func TestPollAuditLookback(t *testing.T) {
+	api := &fakeAPI{}
+	api.setAudit("1", "2")
+	api.audit[0].Timestamp = time.Now().Add(-2 * time.Hour)
+	p, err := NewPoller(api.client(t), Config{Lookback: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := stubQueue(t, nil)
+	if err := p.pollAudit(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"2"}; !slices.Equal(*sent, want) {
+		t.Errorf("first poll sent %v, want %v", *sent, want)
+	}
+}
+
+func TestPollTrafficWindow(t *testing.T) {
+	api := &fakeAPI{}
+	client := api.client(t)
+	cfg := Config{Lookback: time.Hour, Overlap: 5 * time.Minute}
+	sent := stubQueue(t, nil)
+
+	p, err := NewPoller(client, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now().UTC()
+	for range 2 {
+		if err := p.pollTraffic(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"flow-1:TYPE_START", "flow-1:TYPE_START"}; !slices.Equal(*sent, want) {
+		t.Fatalf("sent %v, want %v", *sent, want)
+	}
+
+	// The first poll reaches back Lookback, the next re-reads Overlap of the
+	// previous window.
+	first, second := api.startDates[0], api.startDates[1]
+	if d := before.Sub(first); d < time.Hour-time.Second || d > time.Hour+time.Second {
+		t.Errorf("first window starts %v before now, want 1h", d)
+	}
+	if d := before.Sub(second); d < 5*time.Minute-time.Second || d > 5*time.Minute+time.Second {
+		t.Errorf("second window starts %v before now, want 5m", d)
+	}
+}
+
+func TestPollTrafficKeepsWindowUntilDelivered(t *testing.T) {
+	api := &fakeAPI{}
+	cfg := Config{StateFile: filepath.Join(t.TempDir(), "state.json"), Lookback: time.Hour, Overlap: 5 * time.Minute}
+	p, err := NewPoller(api.client(t), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stubQueue(t, map[string]error{"flow-1:TYPE_START": errSinkDown})
+	if err := p.pollTraffic(context.Background()); !errors.Is(err, errSinkDown) {
+		t.Fatalf("pollTraffic = %v, want the delivery error", err)
+	}
+	if state := checkpoint(t, cfg.StateFile); !state.TrafficLastTimestamp.IsZero() {
+		t.Fatalf("checkpoint moved to %v before the window was delivered", state.TrafficLastTimestamp)
+	}
+
+	stubQueue(t, nil)
+	if err := p.pollTraffic(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The retry reads the whole first window again.
+	if d := api.startDates[0].Sub(api.startDates[1]); d < -time.Second || d > time.Second {
+		t.Errorf("retry started at %v, want %v", api.startDates[1], api.startDates[0])
+	}
+	if state := checkpoint(t, cfg.StateFile); state.TrafficLastTimestamp.IsZero() {
+		t.Error("delivered window not checkpointed")
+	}
+}
+
+func TestAuditEnvelope(t *testing.T) {
+	envelope, err := AuditEnvelope(netbird.NetbirdAuditEvent{
+		ID:          "42",
+		Timestamp:   stamp,
+		Activity:    "Peer added",
+		InitiatorID: "user-1",
+		TargetID:    "peer-1",
+		Meta:        map[string]any{"ip": "100.64.0.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if envelope.ID != 42 || envelope.Message != "Peer added" || envelope.InitiatorID != "user-1" || envelope.TargetID != "peer-1" {
+		t.Errorf("envelope = %+v", envelope)
+	}
+	if !envelope.Timestamp.Equal(stamp) {
+		t.Errorf("timestamp = %v, want %v", envelope.Timestamp, stamp)
+	}
+
+	if _, err := AuditEnvelope(netbird.NetbirdAuditEvent{ID: "abc"}); err == nil {
+		t.Error("non-numeric ID accepted")
+	}
+}
+
+func TestTrafficEvents(t *testing.T) {
+	flow := netbird.NetbirdTrafficFlow{
+		FlowID:     "flow-1",
+		ReporterID: "peer-1",
+		Protocol:   6,
+		Direction:  "INGRESS",
+		Source:     netbird.NetbirdTrafficEndpoint{Address: "100.64.0.10:51234", Name: "laptop-1"},
+		Events: []netbird.NetbirdTrafficFlowStep{
+			{ID: "step-1", Type: "TYPE_START", Timestamp: stamp},
+			{Type: "TYPE_END", Timestamp: stamp.Add(time.Minute)},
+		},
+	}
+	events := TrafficEvents(flow)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].ID != "step-1" || events[1].ID != "flow-1:TYPE_END" {
+		t.Errorf("IDs = %q, %q", events[0].ID, events[1].ID)
+	}
+	for _, ev := range events {
+		if ev.InitiatorID != "peer-1" || ev.Meta.FlowID != "flow-1" || ev.Meta.Protocol != 6 || ev.Meta.SourceName != "laptop-1" {
+			t.Errorf("event %s = %+v", ev.ID, ev)
+		}
+	}
+	if events[1].Meta.ReceivedTimestamp != "2026-01-01T12:01:00Z" {
+		t.Errorf("received timestamp = %q", events[1].Meta.ReceivedTimestamp)
+	}
+}
+
+func TestLoadState(t *testing.T) {
+	dir := t.TempDir()
+	s, err := LoadState(filepath.Join(dir, "missing.json"))
+	if err != nil || s.AuditLastID != 0 {
+		t.Fatalf("LoadState(missing) = %+v, %v", s, err)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState(bad); err == nil {
+		t.Error("corrupt state accepted")
+	}
+}
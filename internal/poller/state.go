@@ -0,0 +1,65 @@
+package poller
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// State is the poller checkpoint persisted between restarts.
+type State struct {
+	AuditLastID          int64     `json:"audit_last_id"`
+	TrafficLastTimestamp time.Time `json:"traffic_last_timestamp"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// LoadState reads the checkpoint at path. A missing file yields an empty
+// state; an empty path keeps the state in memory only.
+func LoadState(path string) (*State, error) {
+	s := &State{path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read poller state: %w", err)
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("decode poller state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save writes the checkpoint atomically.
+func (s *State) Save() error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o750); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o640); err != nil {
+		return fmt.Errorf("write poller state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("write poller state: %w", err)
+	}
+	return nil
+}
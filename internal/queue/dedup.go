@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Key identifies an event independently of whether it arrived through the
+// webhook or the poller. An empty key disables de-duplication for the job.
+func (j Job) Key() string {
+	switch {
+	case j.Traffic != nil:
+		m := j.Traffic.Meta
+		if m.FlowID == "" {
+			return ""
+		}
+		return "traffic|" + m.FlowID + "|" + m.ReporterID + "|" + j.Traffic.Message
+	case j.Audit != nil:
+		// Webhook payloads without an ID cannot be told apart.
+		if j.Audit.ID == 0 {
+			return ""
+		}
+		return "audit|" + strconv.Itoa(j.Audit.ID)
+	}
+	return ""
+}
+
+func (j Job) kind() string {
+	if j.Audit != nil {
+		return "audit"
+	}
+	return "traffic"
+}
+
+// seenCache remembers recently enqueued keys for ttl.
+type seenCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]time.Time
+	lastSweep time.Time
+}
+
+func newSeenCache(ttl time.Duration) *seenCache {
+	return &seenCache{ttl: ttl, entries: make(map[string]time.Time)}
+}
+
+// add records key and reports whether it was new. A key seen within ttl is
+// left untouched and reported as a duplicate.
+func (c *seenCache) add(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if at, ok := c.entries[key]; ok && now.Sub(at) < c.ttl {
+		return false
+	}
+	c.entries[key] = now
+	if now.Sub(c.lastSweep) > c.ttl {
+		for k, at := range c.entries {
+			if now.Sub(at) >= c.ttl {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	return true
+}
+
+// remove forgets key, so a job that could not be enqueued is not taken for a
+// duplicate when it is retried.
+func (c *seenCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/metrics"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func audit(t *testing.T, payload string) *apicontracts.AuditEventEnvelope {
+	t.Helper()
+	var ev apicontracts.AuditEventEnvelope
+	if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+		t.Fatal(err)
+	}
+	return &ev
+}
+
+func TestJobKey(t *testing.T) {
+	tests := []struct {
+		name string
+		job  Job
+		want string
+	}{
+		{"audit numeric id", Job{Audit: audit(t, `{"ID": 42, "Message": "User joined"}`)}, "audit|42"},
+		{"audit string id", Job{Audit: audit(t, `{"ID": "43", "Message": "User joined"}`)}, "audit|43"},
+		{"audit without id", Job{Audit: audit(t, `{"Message": "User joined"}`)}, ""},
+		{"traffic", Job{Traffic: &apicontracts.TrafficEvent{Message: "TYPE_START", Meta: apicontracts.TrafficMeta{FlowID: "f1", ReporterID: "r1"}}}, "traffic|f1|r1|TYPE_START"},
+		{"traffic without flow id", Job{Traffic: &apicontracts.TrafficEvent{Message: "TYPE_START"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.job.Key(); got != tt.want {
+				t.Errorf("Key() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// queueWithoutWorkers lets the tests inspect what was enqueued.
+func queueWithoutWorkers(size int) *Queue {
+	return &Queue{jobs: make(chan Job, size)}
+}
+
+func TestEnqueueDedup(t *testing.T) {
+	q := queueWithoutWorkers(10)
+	q.EnableDedup(time.Minute)
+	before := testutil.ToFloat64(metrics.QueueDuplicates.WithLabelValues("audit"))
+
+	first := Job{Audit: audit(t, `{"ID": 1, "Message": "a"}`)}
+	for range 2 {
+		if err := q.Enqueue(first); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.Len() != 1 {
+		t.Fatalf("queued %d jobs, want 1", q.Len())
+	}
+	if got := testutil.ToFloat64(metrics.QueueDuplicates.WithLabelValues("audit")) - before; got != 1 {
+		t.Errorf("duplicates counted %v, want 1", got)
+	}
+
+	// Pushed audit events carry no ID and must never be treated as duplicates.
+	for range 3 {
+		q.Enqueue(Job{Audit: audit(t, `{"Message": "b"}`)})
+	}
+	if q.Len() != 4 {
+		t.Fatalf("queued %d jobs, want 4", q.Len())
+	}
+}
+
+func TestEnqueueDedupConcurrent(t *testing.T) {
+	q := queueWithoutWorkers(100)
+	q.EnableDedup(time.Minute)
+	job := Job{Audit: audit(t, `{"ID": 7, "Message": "a"}`)}
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Go(func() {
+			if err := q.Enqueue(job); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	if q.Len() != 1 {
+		t.Errorf("queued %d copies, want 1", q.Len())
+	}
+}
+
+func TestEnqueueRollsBackFailedSend(t *testing.T) {
+	q := queueWithoutWorkers(1)
+	q.EnableDedup(time.Minute)
+	job := Job{Audit: audit(t, `{"ID": 8, "Message": "a"}`)}
+
+	if err := q.Enqueue(Job{Audit: audit(t, `{"ID": 1, "Message": "a"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(job); !errors.Is(err, ErrFull) {
+		t.Fatalf("Enqueue on full queue = %v, want ErrFull", err)
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.EnqueueWait(ctx, job); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("EnqueueWait on full queue = %v, want deadline exceeded", err)
+	}
+
+	// Neither failed attempt may mark the job as seen.
+	<-q.jobs
+	if err := q.Enqueue(job); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("retried job was dropped as a duplicate")
+	}
+}
+
+func TestDuplicateIsDone(t *testing.T) {
+	q := queueWithoutWorkers(10)
+	q.EnableDedup(time.Minute)
+
+	done := 0
+	job := Job{Audit: audit(t, `{"ID": 9, "Message": "a"}`), Done: func(err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		done++
+	}}
+	for range 2 {
+		if err := q.Enqueue(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the duplicate is done; the first copy waits for a worker.
+	if done != 1 {
+		t.Errorf("Done called %d times, want 1", done)
+	}
+}
+
+func TestSeenCacheExpiry(t *testing.T) {
+	c := newSeenCache(20 * time.Millisecond)
+	if !c.add("k") {
+		t.Fatal("new key reported as duplicate")
+	}
+	if c.add("k") {
+		t.Fatal("key not remembered")
+	}
+	time.Sleep(30 * time.Millisecond)
+	c.add("other")
+	if _, ok := c.entries["k"]; ok {
+		t.Error("expired key not swept")
+	}
+	if !c.add("k") {
+		t.Fatal("key remembered past ttl")
+	}
+}
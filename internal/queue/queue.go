@@ -0,0 +1,194 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/metrics"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/services"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+var GlobalQueue *Queue
+
+var (
+	ErrFull   = errors.New("queue full")
+	ErrClosed = errors.New("queue closed")
+)
+
+// Job is one decoded webhook payload waiting for enrichment and delivery.
+// Exactly one of Traffic and Audit is set.
+type Job struct {
+	Traffic *apicontracts.TrafficEvent
+	Audit   *apicontracts.AuditEventEnvelope
+
+	// Done, when set, is called once the job has been processed, or right
+	// away when it is dropped as a duplicate. It is not called when the job
+	// could not be enqueued.
+	Done func(err error)
+}
+
+// Queue is a bounded in-memory buffer drained by a fixed pool of workers.
+type Queue struct {
+	jobs chan Job
+	wg   sync.WaitGroup
+	seen *seenCache
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewQueue(size, workers int) *Queue {
+	if size <= 0 {
+		size = 10000
+	}
+	if workers <= 0 {
+		workers = 4
+	}
+
+	q := &Queue{jobs: make(chan Job, size)}
+	q.wg.Add(workers)
+	for range workers {
+		go q.worker()
+	}
+	return q
+}
+
+func InitQueue(size, workers int) {
+	GlobalQueue = NewQueue(size, workers)
+}
+
+// EnableDedup drops jobs whose Key was enqueued within ttl. Used when events
+// arrive through both the webhook and the poller.
+func (q *Queue) EnableDedup(ttl time.Duration) {
+	q.seen = newSeenCache(ttl)
+}
+
+// Enqueue adds a job without blocking. It returns ErrFull when the queue is
+// full and ErrClosed when shutting down. Duplicates are accepted, counted and
+// discarded.
+func (q *Queue) Enqueue(job Job) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	key, dup := q.markSeen(job)
+	if dup {
+		metrics.QueueDuplicates.WithLabelValues(job.kind()).Inc()
+		job.done(nil)
+		return nil
+	}
+
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		q.forget(key)
+		return ErrFull
+	}
+}
+
+// EnqueueWait adds a job, waiting for room in the queue.
+func (q *Queue) EnqueueWait(ctx context.Context, job Job) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrClosed
+	}
+
+	key, dup := q.markSeen(job)
+	if dup {
+		metrics.QueueDuplicates.WithLabelValues(job.kind()).Inc()
+		job.done(nil)
+		return nil
+	}
+
+	select {
+	case q.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		q.forget(key)
+		return ctx.Err()
+	}
+}
+
+// markSeen records the key of job before it is sent, so two concurrent
+// copies cannot both get in. It reports whether the job is a duplicate.
+func (q *Queue) markSeen(job Job) (key string, dup bool) {
+	if q.seen == nil {
+		return "", false
+	}
+	if key = job.Key(); key == "" {
+		return "", false
+	}
+	return key, !q.seen.add(key)
+}
+
+func (q *Queue) forget(key string) {
+	if key != "" {
+		q.seen.remove(key)
+	}
+}
+
+func (q *Queue) Len() int {
+	return len(q.jobs)
+}
+
+func (q *Queue) Cap() int {
+	return cap(q.jobs)
+}
+
+// Close stops accepting jobs and waits for the workers to drain the queue.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.jobs)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		err := process(job)
+		if err != nil && q.seen != nil {
+			// Let a redelivery of the event through.
+			q.forget(job.Key())
+		}
+		job.done(err)
+	}
+}
+
+func (j Job) done(err error) {
+	if j.Done != nil {
+		j.Done(err)
+	}
+}
+
+func process(job Job) error {
+	ctx := context.Background()
+
+	switch {
+	case job.Traffic != nil:
+		if _, err := services.ProcessTrafficEvent(ctx, *job.Traffic); err != nil && !errors.Is(err, services.ErrFiltered) {
+			logger.Log.Errorf("Failed to process traffic event %s: %v", job.Traffic.ID, err)
+			return err
+		}
+	case job.Audit != nil:
+		if _, err := services.ProcessAuditEvent(ctx, *job.Audit); err != nil && !errors.Is(err, services.ErrFiltered) {
+			logger.Log.Errorf("Failed to process audit event %d: %v", job.Audit.ID, err)
+			return err
+		}
+	}
+	return nil
+}
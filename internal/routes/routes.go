@@ -1,10 +1,16 @@
 package routes
 
 import (
+	"github.com/NorskHelsenett/netbird-log-forwarder/cmd/settings"
 	"github.com/NorskHelsenett/netbird-log-forwarder/internal/handlers"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func SetupRoutes(server *gin.Engine) {
-	server.POST("/webhook", handlers.RecieveEvent)
+	if settings.PushEnabled() {
+		server.POST("/webhook", handlers.RecieveEvent)
+	}
+	server.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	server.POST("/alerting/test", handlers.TestAlert)
 }
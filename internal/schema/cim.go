@@ -0,0 +1,162 @@
+package schema
+
+import (
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+const vendorProduct = "NetBird"
+
+// CIM maps events to the Splunk Common Information Model. Traffic and flows
+// follow the Network_Traffic data model, audit logins the Authentication
+// data model and all other audit activity the Change data model.
+type CIM struct{}
+
+func (CIM) Traffic(_ time.Time, ev *apicontracts.SplunkTrafficEvent) any {
+	doc := cimTraffic(ev)
+	doc["action"] = cimTrafficAction(ev.Message)
+	return doc
+}
+
+func (CIM) Flow(_ time.Time, ev *apicontracts.SplunkFlowEvent) any {
+	doc := cimTraffic(&ev.Traffic)
+	doc["action"] = "allowed"
+	if ev.State == "dropped" {
+		doc["action"] = "blocked"
+	}
+	doc["session_id"] = ev.FlowID
+	doc["duration"] = ev.Duration
+	doc["flow_state"] = ev.State
+	doc["bytes_in"] = ev.RxBytes
+	doc["bytes_out"] = ev.TxBytes
+	doc["bytes"] = ev.RxBytes + ev.TxBytes
+	doc["packets_in"] = ev.RxPackets
+	doc["packets_out"] = ev.TxPackets
+	doc["packets"] = ev.RxPackets + ev.TxPackets
+	doc["start_time"] = ev.Start.UTC().Format(time.RFC3339Nano)
+	doc["end_time"] = ev.End.UTC().Format(time.RFC3339Nano)
+	return doc
+}
+
+func cimTraffic(ev *apicontracts.SplunkTrafficEvent) map[string]any {
+	doc := make(map[string]any, len(ev.Fields)+32)
+	for k, v := range ev.Fields {
+		doc[k] = v
+	}
+
+	doc["vendor_product"] = vendorProduct
+	doc["protocol"] = "ip"
+	doc["transport"] = strings.ToLower(ev.Protocol)
+	doc["src"] = firstNonEmpty(ev.SourceName, ev.SrcIP)
+	doc["src_ip"] = ev.SrcIP
+	doc["src_port"] = ev.SrcPort
+	doc["dest"] = firstNonEmpty(ev.DstHostname, ev.DstResource, ev.DstName, ev.DstIP)
+	doc["dest_ip"] = ev.DstIP
+	doc["dest_port"] = ev.DstPort
+	doc["bytes_in"] = ev.RxBytes
+	doc["bytes_out"] = ev.TxBytes
+	doc["bytes"] = ev.RxBytes + ev.TxBytes
+	doc["packets_in"] = ev.RxPackets
+	doc["packets_out"] = ev.TxPackets
+	doc["packets"] = ev.RxPackets + ev.TxPackets
+	doc["dvc"] = ev.ExitNode
+
+	setIf(doc, "user", ev.Email)
+	setIf(doc, "src_user", ev.Email)
+	setIf(doc, "dest_user", firstNonEmpty(ev.DstEmail, ev.DstUser))
+	setIf(doc, "src_translated_ip", ev.SrcTranslatedIP)
+	setIf(doc, "rule", ev.PolicyName)
+	setIf(doc, "rule_id", ev.PolicyID)
+	setIf(doc, "session_id", ev.FlowID)
+	setIf(doc, "direction", cimDirection(ev.Direction))
+	setIf(doc, "src_category", strings.ToLower(ev.SrcType))
+	setIf(doc, "dest_category", strings.ToLower(ev.DstType))
+	setIf(doc, "dvc_id", ev.ReporterID)
+	if ev.ICMPType != nil {
+		doc["icmp_type"] = *ev.ICMPType
+	}
+	if ev.ICMPCode != nil {
+		doc["icmp_code"] = *ev.ICMPCode
+	}
+	if ev.CacheStale {
+		doc["cache_stale"] = true
+	}
+	return doc
+}
+
+func cimTrafficAction(message string) string {
+	if strings.EqualFold(message, "TYPE_DROP") {
+		return "blocked"
+	}
+	return "allowed"
+}
+
+func cimDirection(direction string) string {
+	switch strings.ToUpper(direction) {
+	case "INGRESS":
+		return "inbound"
+	case "EGRESS":
+		return "outbound"
+	}
+	return ""
+}
+
+func (CIM) Audit(_ time.Time, ev *apicontracts.SplunkAuditEvent) any {
+	doc := make(map[string]any, len(ev.Extra)+16)
+	for k, v := range ev.Extra {
+		doc[k] = v
+	}
+
+	doc["vendor_product"] = vendorProduct
+	doc["app"] = "netbird"
+	doc["signature"] = ev.Message
+	doc["signature_id"] = ev.ActivityCode
+	setIf(doc, "severity", ev.ActivitySeverity)
+	doc["src_user"] = ev.InitiatorID
+	setIf(doc, "src", stringFrom(ev.Extra, "ip", "location_connection_ip"))
+	if ev.CacheStale {
+		doc["cache_stale"] = true
+	}
+
+	// Authentication
+	if ev.ActivityAction == "login" {
+		doc["action"] = "success"
+		doc["user"] = firstNonEmpty(ev.InitiatorID, ev.TargetName, ev.TargetID)
+		doc["dest"] = firstNonEmpty(ev.TargetName, stringFrom(ev.Extra, "fqdn"), "netbird")
+		return doc
+	}
+
+	// Change
+	doc["action"] = cimChangeAction(ev.ActivityAction)
+	doc["change_type"] = firstNonEmpty(ev.ActivityCategory, "unknown")
+	doc["command"] = ev.ActivityCode
+	doc["object"] = firstNonEmpty(ev.TargetName, ev.TargetID)
+	doc["object_id"] = ev.TargetID
+	doc["object_category"] = firstNonEmpty(ev.TargetType, "unknown")
+	doc["status"] = "success"
+	doc["user"] = ev.InitiatorID
+	doc["dest"] = "netbird"
+	return doc
+}
+
+// cimChangeAction maps an activity action to the Change action values
+// (created, deleted, modified, ...).
+func cimChangeAction(action string) string {
+	switch action {
+	case "create":
+		return "created"
+	case "delete":
+		return "deleted"
+	case "":
+		return "unknown"
+	case "block":
+		return "blocked"
+	case "revoke":
+		return "revoked"
+	case "reject":
+		return "rejected"
+	}
+	return "modified"
+}
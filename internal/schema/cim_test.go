@@ -0,0 +1,58 @@
+package schema
+
+import "testing"
+
+// The CIM data model follows from the activity action, so check the action
+// values apart from the golden files.
+func TestCIMAuditActions(t *testing.T) {
+	tests := []struct {
+		action     string
+		wantAction string
+		wantChange bool
+	}{
+		{"login", "success", false},
+		{"create", "created", true},
+		{"delete", "deleted", true},
+		{"update", "modified", true},
+		{"enable", "modified", true},
+		{"block", "blocked", true},
+		{"revoke", "revoked", true},
+		{"reject", "rejected", true},
+		{"", "unknown", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			ev := accountChangeFixture()
+			ev.ActivityAction = tt.action
+			doc := CIM{}.Audit(goldenTime, ev).(map[string]any)
+			if doc["action"] != tt.wantAction {
+				t.Errorf("action = %v, want %s", doc["action"], tt.wantAction)
+			}
+			if _, isChange := doc["change_type"]; isChange != tt.wantChange {
+				t.Errorf("change_type set %t, want %t", isChange, tt.wantChange)
+			}
+		})
+	}
+}
+
+func TestCIMFlowAction(t *testing.T) {
+	for state, want := range map[string]string{"completed": "allowed", "timeout": "allowed", "dropped": "blocked"} {
+		ev := flowFixture()
+		ev.State = state
+		doc := CIM{}.Flow(goldenTime, ev).(map[string]any)
+		if got := doc["action"]; got != want {
+			t.Errorf("flow %s action = %v, want %s", state, got, want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{"", "native", "CIM", "ocsf", "ecs-8.11"} {
+		if _, err := Lookup(name); err != nil {
+			t.Errorf("Lookup(%q): %v", name, err)
+		}
+	}
+	if _, err := Lookup("leef"); err == nil {
+		t.Error("unknown profile accepted")
+	}
+}
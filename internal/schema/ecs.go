@@ -0,0 +1,215 @@
+package schema
+
+import (
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+// ECS maps events to the Elastic Common Schema. NetBird specific fields that
+// have no ECS counterpart go under netbird.*.
+type ECS struct {
+	Version string
+}
+
+func (e ECS) Traffic(ts time.Time, ev *apicontracts.SplunkTrafficEvent) any {
+	doc := e.network(ts, ev, ev.RxBytes, ev.TxBytes, ev.RxPackets, ev.TxPackets)
+	event := doc["event"].(map[string]any)
+	switch strings.ToUpper(ev.Message) {
+	case "TYPE_START":
+		event["type"] = []string{"connection", "start", "allowed"}
+	case "TYPE_END":
+		event["type"] = []string{"connection", "end", "allowed"}
+	case "TYPE_DROP":
+		event["type"] = []string{"connection", "denied"}
+	}
+	return compact(doc)
+}
+
+func (e ECS) Flow(ts time.Time, ev *apicontracts.SplunkFlowEvent) any {
+	doc := e.network(ts, &ev.Traffic, ev.RxBytes, ev.TxBytes, ev.RxPackets, ev.TxPackets)
+	event := doc["event"].(map[string]any)
+	event["kind"] = "event"
+	event["dataset"] = "netbird.flow"
+	event["action"] = "flow_" + ev.State
+	event["start"] = ev.Start.UTC().Format(time.RFC3339Nano)
+	event["end"] = ev.End.UTC().Format(time.RFC3339Nano)
+	event["duration"] = ev.End.Sub(ev.Start).Nanoseconds()
+	event["type"] = []string{"connection", "end", "allowed"}
+	if ev.State == "dropped" {
+		event["type"] = []string{"connection", "denied"}
+	}
+	nb := doc["netbird"].(map[string]any)
+	nb["flow_state"] = ev.State
+	nb["event_count"] = ev.EventCount
+	return compact(doc)
+}
+
+func (e ECS) network(ts time.Time, ev *apicontracts.SplunkTrafficEvent, rxBytes, txBytes, rxPackets, txPackets int) map[string]any {
+	outcome := "success"
+	if strings.EqualFold(ev.Message, "TYPE_DROP") {
+		outcome = "failure"
+	}
+
+	source := map[string]any{
+		"ip":      ev.SrcIP,
+		"port":    ev.SrcPort,
+		"address": firstNonEmpty(ev.SrcIP, ev.SourceName),
+		"domain":  ev.SrcDNSLabel,
+		"bytes":   txBytes,
+		"packets": txPackets,
+		"geo":     map[string]any{"country_iso_code": ev.SrcCountry, "city_name": ev.SrcCity},
+		"user":    map[string]any{"email": ev.Email},
+	}
+	if ev.SrcTranslatedIP != "" {
+		source["nat"] = map[string]any{"ip": ev.SrcTranslatedIP}
+	}
+
+	return map[string]any{
+		"@timestamp": ts.UTC().Format(time.RFC3339Nano),
+		"ecs":        map[string]any{"version": e.Version},
+		"message":    ev.Message,
+		"event": map[string]any{
+			"kind":     "event",
+			"category": []string{"network"},
+			"action":   strings.ToLower(strings.TrimPrefix(strings.ToUpper(ev.Message), "TYPE_")),
+			"outcome":  outcome,
+			"module":   "netbird",
+			"dataset":  "netbird.traffic",
+			"id":       ev.FlowID,
+		},
+		"source": source,
+		"destination": map[string]any{
+			"ip":      ev.DstIP,
+			"port":    ev.DstPort,
+			"address": firstNonEmpty(ev.DstIP, ev.DstHostname),
+			"domain":  firstNonEmpty(ev.DstDNSLabel, ev.DstHostname),
+			"bytes":   rxBytes,
+			"packets": rxPackets,
+			"geo":     map[string]any{"country_iso_code": ev.DstCountry, "city_name": ev.DstCity},
+			"user":    map[string]any{"email": ev.DstEmail, "name": ev.DstUser},
+		},
+		"network": map[string]any{
+			"transport": strings.ToLower(ev.Protocol),
+			"direction": strings.ToLower(ev.Direction),
+			"bytes":     rxBytes + txBytes,
+			"packets":   rxPackets + txPackets,
+		},
+		"observer": map[string]any{
+			"hostname": ev.ExitNode,
+			"vendor":   "NetBird",
+			"product":  "NetBird",
+			"type":     "firewall",
+		},
+		"user": map[string]any{"email": ev.Email},
+		"rule": map[string]any{"name": ev.PolicyName, "id": ev.PolicyID},
+		"netbird": merge(ev.Fields, map[string]any{
+			"flow_id":           ev.FlowID,
+			"reporter_id":       ev.ReporterID,
+			"reported_by":       ev.ReportedBy,
+			"src_id":            ev.SrcID,
+			"src_type":          ev.SrcType,
+			"src_groups":        ev.SrcGroups,
+			"src_os":            ev.SrcOS,
+			"src_version":       ev.SrcVersion,
+			"dst_id":            ev.DstID,
+			"dst_type":          ev.DstType,
+			"dst_groups":        ev.DstGroups,
+			"dst_os":            ev.DstOS,
+			"dst_version":       ev.DstVersion,
+			"dst_resource":      ev.DstResource,
+			"dst_network":       ev.DstNetwork,
+			"policy_src_groups": ev.PolicySrcGroups,
+			"policy_dst_groups": ev.PolicyDstGroups,
+			"icmp":              icmp(ev),
+			"cache_stale":       ev.CacheStale,
+		}),
+	}
+}
+
+func icmp(ev *apicontracts.SplunkTrafficEvent) map[string]any {
+	if ev.ICMPType == nil || ev.ICMPCode == nil {
+		return nil
+	}
+	return map[string]any{"type": *ev.ICMPType, "code": *ev.ICMPCode}
+}
+
+func (e ECS) Audit(ts time.Time, ev *apicontracts.SplunkAuditEvent) any {
+	category, types := []string{"configuration"}, []string{"change"}
+	switch {
+	case ev.ActivityAction == "login":
+		category, types = []string{"authentication"}, []string{"start"}
+	case ev.TargetType == "user":
+		category = []string{"iam"}
+		types = []string{"user", ecsChangeType(ev.ActivityAction)}
+	case ev.TargetType == "group":
+		category = []string{"iam"}
+		types = []string{"group", ecsChangeType(ev.ActivityAction)}
+	default:
+		types = []string{ecsChangeType(ev.ActivityAction)}
+	}
+
+	doc := map[string]any{
+		"@timestamp": ts.UTC().Format(time.RFC3339Nano),
+		"ecs":        map[string]any{"version": e.Version},
+		"message":    ev.Message,
+		"event": map[string]any{
+			"kind":     "event",
+			"category": category,
+			"type":     types,
+			"action":   ev.ActivityCode,
+			"outcome":  "success",
+			"module":   "netbird",
+			"dataset":  "netbird.audit",
+			"severity": ecsSeverity(ev.ActivitySeverity),
+			"original": ev.RawEvent,
+		},
+		"user": map[string]any{
+			"name": ev.InitiatorID,
+		},
+		"source": map[string]any{"ip": stringFrom(ev.Extra, "ip", "location_connection_ip")},
+		"netbird": map[string]any{
+			"activity": map[string]any{
+				"code":     ev.ActivityCode,
+				"category": ev.ActivityCategory,
+				"action":   ev.ActivityAction,
+				"severity": ev.ActivitySeverity,
+				"unknown":  ev.ActivityUnknown,
+			},
+			"target": map[string]any{
+				"id":   ev.TargetID,
+				"type": ev.TargetType,
+				"name": ev.TargetName,
+			},
+			"meta":        merge(ev.Extra),
+			"cache_stale": ev.CacheStale,
+		},
+	}
+	if ev.TargetType == "user" {
+		doc["user"].(map[string]any)["target"] = map[string]any{"name": ev.TargetName, "id": ev.TargetID}
+	}
+	return compact(doc)
+}
+
+func ecsChangeType(action string) string {
+	switch action {
+	case "create":
+		return "creation"
+	case "delete":
+		return "deletion"
+	}
+	return "change"
+}
+
+func ecsSeverity(severity string) int {
+	switch severity {
+	case "low":
+		return 1
+	case "medium":
+		return 2
+	case "high":
+		return 3
+	}
+	return 0
+}
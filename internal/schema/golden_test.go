@@ -0,0 +1,222 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+// go test ./internal/schema -update rewrites the golden files.
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var goldenTime = time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+
+func icmpValue(v int) *int { return &v }
+
+func trafficFixture() *apicontracts.SplunkTrafficEvent {
+	return &apicontracts.SplunkTrafficEvent{
+		Protocol:        "TCP",
+		SrcIP:           "100.64.0.10",
+		SrcPort:         51234,
+		SourceName:      "laptop-1",
+		Email:           "alice@example.com",
+		DstIP:           "10.0.0.5",
+		DstPort:         443,
+		ExitNode:        "router-1",
+		Message:         "TYPE_DROP",
+		SrcTranslatedIP: "192.0.2.10",
+		ReportedBy:      "destination",
+		SrcGroups:       []string{"Developers"},
+		SrcOS:           "linux",
+		SrcVersion:      "0.40.0",
+		SrcCountry:      "NO",
+		SrcCity:         "Oslo",
+		DstGroups:       []string{"Servers"},
+		DstHostname:     "db.internal",
+		DstResource:     "database",
+		DstNetwork:      "prod",
+		PolicyID:        "policy-1",
+		PolicyName:      "Developers to servers",
+		FlowID:          "3c5e1a2b-8f4d-4b6e-9a7c-1d2e3f4a5b6c",
+		Direction:       "EGRESS",
+		ReporterID:      "peer-1",
+		SrcID:           "peer-1",
+		SrcType:         "peer",
+		DstID:           "resource-1",
+		DstType:         "host_resource",
+		RxBytes:         1200,
+		TxBytes:         800,
+		RxPackets:       10,
+		TxPackets:       8,
+		Fields:          map[string]any{"tx_kb": 0},
+	}
+}
+
+func icmpFixture() *apicontracts.SplunkTrafficEvent {
+	ev := trafficFixture()
+	ev.Protocol, ev.Message, ev.Direction = "ICMP", "TYPE_START", "INGRESS"
+	ev.SrcPort, ev.DstPort = 0, 0
+	ev.ICMPType, ev.ICMPCode = icmpValue(8), icmpValue(0)
+	ev.SrcTranslatedIP, ev.Fields = "", nil
+	return ev
+}
+
+func flowFixture() *apicontracts.SplunkFlowEvent {
+	traffic := trafficFixture()
+	traffic.Message = "TYPE_END"
+	return &apicontracts.SplunkFlowEvent{
+		FlowID:     traffic.FlowID,
+		Start:      goldenTime.Add(-90 * time.Second),
+		End:        goldenTime,
+		Duration:   90,
+		State:      "completed",
+		RxBytes:    5000,
+		TxBytes:    3000,
+		RxPackets:  40,
+		TxPackets:  30,
+		EventCount: 2,
+		Traffic:    *traffic,
+	}
+}
+
+func loginFixture() *apicontracts.SplunkAuditEvent {
+	return &apicontracts.SplunkAuditEvent{
+		Message:          "User logged in peer",
+		InitiatorID:      "alice@example.com",
+		TargetID:         "peer-1",
+		TargetType:       "peer",
+		TargetName:       "laptop-1",
+		RawEvent:         `{"ID":101,"Message":"User logged in peer"}`,
+		ActivityCode:     "user.peer.login",
+		ActivityCategory: "peer",
+		ActivityAction:   "login",
+		ActivitySeverity: "low",
+		Extra:            map[string]any{"ip": "198.51.100.7", "fqdn": "laptop-1.netbird.cloud"},
+	}
+}
+
+func accountChangeFixture() *apicontracts.SplunkAuditEvent {
+	return &apicontracts.SplunkAuditEvent{
+		Message:          "User blocked",
+		InitiatorID:      "admin@example.com",
+		TargetID:         "user-2",
+		TargetType:       "user",
+		TargetName:       "bob@example.com",
+		RawEvent:         `{"ID":102,"Message":"User blocked"}`,
+		ActivityCode:     "user.block",
+		ActivityCategory: "user_management",
+		ActivityAction:   "block",
+		ActivitySeverity: "high",
+		Extra:            map[string]any{"email": "bob@example.com"},
+	}
+}
+
+func entityManagementFixture() *apicontracts.SplunkAuditEvent {
+	return &apicontracts.SplunkAuditEvent{
+		Message:          "Group created",
+		InitiatorID:      "admin@example.com",
+		TargetID:         "group-1",
+		TargetType:       "group",
+		TargetName:       "Servers",
+		RawEvent:         `{"ID":103,"Message":"Group created"}`,
+		ActivityCode:     "group.add",
+		ActivityCategory: "group",
+		ActivityAction:   "create",
+		ActivitySeverity: "medium",
+		ActivityUnknown:  false,
+		CacheStale:       true,
+	}
+}
+
+func TestGolden(t *testing.T) {
+	cases := []struct {
+		name   string
+		render func(m Mapper) any
+	}{
+		{"traffic", func(m Mapper) any { return m.Traffic(goldenTime, trafficFixture()) }},
+		{"traffic_icmp", func(m Mapper) any { return m.Traffic(goldenTime, icmpFixture()) }},
+		{"flow", func(m Mapper) any { return m.Flow(goldenTime, flowFixture()) }},
+		{"audit_login", func(m Mapper) any { return m.Audit(goldenTime, loginFixture()) }},
+		{"audit_account_change", func(m Mapper) any { return m.Audit(goldenTime, accountChangeFixture()) }},
+		{"audit_entity_management", func(m Mapper) any { return m.Audit(goldenTime, entityManagementFixture()) }},
+	}
+
+	for _, profile := range []string{"cim", "ocsf-1.1", "ecs-8.11"} {
+		m, err := Lookup(profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range cases {
+			t.Run(profile+"/"+c.name, func(t *testing.T) {
+				got, err := json.MarshalIndent(c.render(m), "", "  ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, '\n')
+
+				file := filepath.Join("testdata", profile, c.name+".json")
+				if *update {
+					if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(file, got, 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatalf("%v (run with -update to create it)", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s differs from the golden file:\n%s", file, got)
+				}
+			})
+		}
+	}
+}
+
+// The OCSF class follows from the event, so check it apart from the golden
+// files where a wrong class is easy to overlook.
+func TestOCSFClasses(t *testing.T) {
+	m := OCSF{Version: "1.1.0"}
+	tests := []struct {
+		name      string
+		doc       any
+		wantClass int
+		wantType  int
+	}{
+		{"traffic refused", m.Traffic(goldenTime, trafficFixture()), ocsfNetworkActivity, 400105},
+		{"flow", m.Flow(goldenTime, flowFixture()), ocsfNetworkActivity, 400106},
+		{"login", m.Audit(goldenTime, loginFixture()), ocsfAuthentication, 300201},
+		{"user blocked", m.Audit(goldenTime, accountChangeFixture()), ocsfAccountChange, 300105},
+		{"group created", m.Audit(goldenTime, entityManagementFixture()), ocsfEntityManagement, 300401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := tt.doc.(map[string]any)
+			if doc["class_uid"] != tt.wantClass || doc["type_uid"] != tt.wantType {
+				t.Errorf("class_uid %v type_uid %v, want %d %d", doc["class_uid"], doc["type_uid"], tt.wantClass, tt.wantType)
+			}
+		})
+	}
+}
+
+// Mappers must not modify the maps of the event, which other sinks share.
+func TestMappersDoNotModifyEvent(t *testing.T) {
+	for _, profile := range Profiles() {
+		m, _ := Lookup(profile)
+		ev := trafficFixture()
+		audit := loginFixture()
+		m.Traffic(goldenTime, ev)
+		m.Audit(goldenTime, audit)
+		if len(ev.Fields) != 1 || len(audit.Extra) != 2 {
+			t.Errorf("%s modified the event: fields %v, extra %v", profile, ev.Fields, audit.Extra)
+		}
+	}
+}
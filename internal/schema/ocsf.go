@@ -0,0 +1,213 @@
+package schema
+
+import (
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+// OCSF maps events to the Open Cybersecurity Schema Framework. Traffic and
+// flows become Network Activity (4001), audit logins Authentication (3002),
+// changes to users and access tokens Account Change (3001) and all other
+// audit activity Entity Management (3004).
+type OCSF struct {
+	Version string
+}
+
+const (
+	ocsfCategoryNetwork = 4
+	ocsfCategoryIAM     = 3
+
+	ocsfNetworkActivity  = 4001
+	ocsfAccountChange    = 3001
+	ocsfAuthentication   = 3002
+	ocsfEntityManagement = 3004
+)
+
+func (o OCSF) Traffic(ts time.Time, ev *apicontracts.SplunkTrafficEvent) any {
+	activity, name := 99, "Other"
+	switch strings.ToUpper(ev.Message) {
+	case "TYPE_START":
+		activity, name = 1, "Open"
+	case "TYPE_END":
+		activity, name = 2, "Close"
+	case "TYPE_DROP":
+		activity, name = 5, "Refuse"
+	}
+	return compact(o.network(ts, ev, activity, name, ev.RxBytes, ev.TxBytes, ev.RxPackets, ev.TxPackets))
+}
+
+func (o OCSF) Flow(ts time.Time, ev *apicontracts.SplunkFlowEvent) any {
+	doc := o.network(ts, &ev.Traffic, 6, "Traffic", ev.RxBytes, ev.TxBytes, ev.RxPackets, ev.TxPackets)
+	doc["start_time"] = ev.Start.UnixMilli()
+	doc["end_time"] = ev.End.UnixMilli()
+	doc["duration"] = ev.End.Sub(ev.Start).Milliseconds()
+	doc["status_detail"] = ev.State
+	doc["count"] = ev.EventCount
+	return compact(doc)
+}
+
+func (o OCSF) network(ts time.Time, ev *apicontracts.SplunkTrafficEvent, activity int, activityName string, rxBytes, txBytes, rxPackets, txPackets int) map[string]any {
+	direction, directionID := "Unknown", 0
+	switch strings.ToUpper(ev.Direction) {
+	case "INGRESS":
+		direction, directionID = "Inbound", 1
+	case "EGRESS":
+		direction, directionID = "Outbound", 2
+	}
+	action, actionID := "Allowed", 1
+	disposition, dispositionID := "Allowed", 1
+	if strings.EqualFold(ev.Message, "TYPE_DROP") {
+		action, actionID = "Denied", 2
+		disposition, dispositionID = "Blocked", 2
+	}
+
+	doc := o.base(ts, ocsfCategoryNetwork, "Network Activity", ocsfNetworkActivity, "Network Activity", activity, activityName)
+	doc["action"], doc["action_id"] = action, actionID
+	doc["disposition"], doc["disposition_id"] = disposition, dispositionID
+	doc["src_endpoint"] = map[string]any{
+		"ip":       ev.SrcIP,
+		"port":     ev.SrcPort,
+		"name":     ev.SourceName,
+		"uid":      ev.SrcID,
+		"type":     ev.SrcType,
+		"location": map[string]any{"country": ev.SrcCountry, "city": ev.SrcCity},
+		"os":       map[string]any{"name": ev.SrcOS, "version": ev.SrcVersion},
+	}
+	if ev.SrcTranslatedIP != "" {
+		doc["src_endpoint"].(map[string]any)["intermediate_ips"] = []string{ev.SrcTranslatedIP}
+	}
+	doc["dst_endpoint"] = map[string]any{
+		"ip":       ev.DstIP,
+		"port":     ev.DstPort,
+		"hostname": ev.DstHostname,
+		"name":     firstNonEmpty(ev.DstResource, ev.DstName),
+		"uid":      ev.DstID,
+		"type":     ev.DstType,
+		"location": map[string]any{"country": ev.DstCountry, "city": ev.DstCity},
+		"os":       map[string]any{"name": ev.DstOS, "version": ev.DstVersion},
+	}
+	doc["connection_info"] = map[string]any{
+		"protocol_name": strings.ToLower(ev.Protocol),
+		"direction":     direction,
+		"direction_id":  directionID,
+		"uid":           ev.FlowID,
+	}
+	doc["traffic"] = map[string]any{
+		"bytes_in":    rxBytes,
+		"bytes_out":   txBytes,
+		"bytes":       rxBytes + txBytes,
+		"packets_in":  rxPackets,
+		"packets_out": txPackets,
+		"packets":     rxPackets + txPackets,
+	}
+	doc["actor"] = map[string]any{"user": map[string]any{"email_addr": ev.Email}}
+	doc["device"] = map[string]any{"hostname": ev.ExitNode, "uid": ev.ReporterID}
+	doc["firewall_rule"] = map[string]any{"name": ev.PolicyName, "uid": ev.PolicyID}
+	unmapped := merge(ev.Fields, map[string]any{
+		"src_groups":        ev.SrcGroups,
+		"dst_groups":        ev.DstGroups,
+		"dst_network":       ev.DstNetwork,
+		"policy_src_groups": ev.PolicySrcGroups,
+		"policy_dst_groups": ev.PolicyDstGroups,
+		"reported_by":       ev.ReportedBy,
+		"cache_stale":       ev.CacheStale,
+	})
+	if ev.ICMPType != nil && ev.ICMPCode != nil {
+		unmapped["icmp_type"], unmapped["icmp_code"] = *ev.ICMPType, *ev.ICMPCode
+	}
+	doc["unmapped"] = unmapped
+	return doc
+}
+
+func (o OCSF) Audit(ts time.Time, ev *apicontracts.SplunkAuditEvent) any {
+	actor := map[string]any{"user": map[string]any{"name": ev.InitiatorID}}
+	src := map[string]any{"ip": stringFrom(ev.Extra, "ip", "location_connection_ip")}
+	unmapped := merge(ev.Extra, map[string]any{
+		"activity_code":     ev.ActivityCode,
+		"activity_category": ev.ActivityCategory,
+		"activity_unknown":  ev.ActivityUnknown,
+		"cache_stale":       ev.CacheStale,
+	})
+
+	var doc map[string]any
+	switch {
+	case ev.ActivityAction == "login":
+		doc = o.base(ts, ocsfCategoryIAM, "Identity & Access Management", ocsfAuthentication, "Authentication", 1, "Logon")
+		doc["user"] = map[string]any{"name": firstNonEmpty(ev.InitiatorID, ev.TargetName)}
+		doc["service"] = map[string]any{"name": "NetBird"}
+
+	case ev.TargetType == "user" || ev.TargetType == "personal_access_token":
+		activity, name := 99, "Other"
+		switch ev.ActivityAction {
+		case "create":
+			activity, name = 1, "Create"
+		case "enable", "unblock", "approve":
+			activity, name = 2, "Enable"
+		case "disable", "block", "reject", "revoke":
+			activity, name = 5, "Disable"
+		case "delete":
+			activity, name = 6, "Delete"
+		}
+		if ev.ActivityCode == "user.password.change" {
+			activity, name = 3, "Password Change"
+		}
+		doc = o.base(ts, ocsfCategoryIAM, "Identity & Access Management", ocsfAccountChange, "Account Change", activity, name)
+		doc["user"] = map[string]any{"name": ev.TargetName, "uid": ev.TargetID}
+
+	default:
+		activity, name := 99, "Other"
+		switch ev.ActivityAction {
+		case "create":
+			activity, name = 1, "Create"
+		case "update", "enable", "disable":
+			activity, name = 3, "Update"
+		case "delete":
+			activity, name = 4, "Delete"
+		}
+		doc = o.base(ts, ocsfCategoryIAM, "Identity & Access Management", ocsfEntityManagement, "Entity Management", activity, name)
+		doc["entity"] = map[string]any{"name": ev.TargetName, "uid": ev.TargetID, "type": ev.TargetType}
+	}
+
+	doc["message"] = ev.Message
+	doc["status"], doc["status_id"] = "Success", 1
+	doc["severity"], doc["severity_id"] = ocsfSeverity(ev.ActivitySeverity)
+	doc["actor"] = actor
+	doc["src_endpoint"] = src
+	doc["raw_data"] = ev.RawEvent
+	doc["unmapped"] = unmapped
+	return compact(doc)
+}
+
+func (o OCSF) base(ts time.Time, category int, categoryName string, class int, className string, activity int, activityName string) map[string]any {
+	return map[string]any{
+		"time":          ts.UnixMilli(),
+		"category_uid":  category,
+		"category_name": categoryName,
+		"class_uid":     class,
+		"class_name":    className,
+		"activity_id":   activity,
+		"activity_name": activityName,
+		"type_uid":      class*100 + activity,
+		"type_name":     className + ": " + activityName,
+		"severity":      "Informational",
+		"severity_id":   1,
+		"metadata": map[string]any{
+			"version": o.Version,
+			"product": map[string]any{"name": "NetBird", "vendor_name": "NetBird"},
+		},
+	}
+}
+
+func ocsfSeverity(severity string) (string, int) {
+	switch severity {
+	case "low":
+		return "Low", 2
+	case "medium":
+		return "Medium", 3
+	case "high":
+		return "High", 4
+	}
+	return "Informational", 1
+}
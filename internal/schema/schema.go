@@ -0,0 +1,135 @@
+package schema
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+// Mapper turns processed events into the documents of one output schema.
+// Each sink is configured with a profile name that selects its mapper.
+type Mapper interface {
+	Traffic(ts time.Time, ev *apicontracts.SplunkTrafficEvent) any
+	Audit(ts time.Time, ev *apicontracts.SplunkAuditEvent) any
+	Flow(ts time.Time, ev *apicontracts.SplunkFlowEvent) any
+}
+
+const DefaultProfile = "native"
+
+// Versioned schemas are registered as <schema>-<version>. The bare schema
+// name points at the newest version, so pin the version where consumers
+// depend on the layout.
+var mappers = map[string]Mapper{
+	DefaultProfile: Native{},
+	"cim":          CIM{},
+	"ocsf-1.1":     OCSF{Version: "1.1.0"},
+	"ocsf":         OCSF{Version: "1.1.0"},
+	"ecs-8.11":     ECS{Version: "8.11.0"},
+	"ecs":          ECS{Version: "8.11.0"},
+}
+
+// Lookup returns the mapper of a profile. An empty name is the native
+// profile.
+func Lookup(name string) (Mapper, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	m, ok := mappers[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown output profile %q, want one of %s", name, strings.Join(Profiles(), ", "))
+	}
+	return m, nil
+}
+
+// Profiles lists the registered profile names.
+func Profiles() []string {
+	names := make([]string, 0, len(mappers))
+	for name := range mappers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Native forwards the events as built by the services, honouring
+// output_fields.
+type Native struct{}
+
+func (Native) Traffic(_ time.Time, ev *apicontracts.SplunkTrafficEvent) any { return ev }
+func (Native) Audit(_ time.Time, ev *apicontracts.SplunkAuditEvent) any     { return ev }
+func (Native) Flow(_ time.Time, ev *apicontracts.SplunkFlowEvent) any       { return ev }
+
+// firstNonEmpty returns the first value that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// setIf adds key to doc unless v is the zero value of its type.
+func setIf[T comparable](doc map[string]any, key string, v T) {
+	var zero T
+	if v != zero {
+		doc[key] = v
+	}
+}
+
+func stringFrom(extra map[string]any, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := extra[k].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// merge copies the maps into a new one, later maps winning.
+func merge(maps ...map[string]any) map[string]any {
+	out := make(map[string]any)
+	for _, m := range maps {
+		for k, v := range m {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// compact returns a copy of doc without empty strings, false, nil, empty
+// lists and empty objects, recursively. Numbers are kept. doc itself is not
+// modified since it may hold maps shared with other sinks.
+func compact(doc map[string]any) map[string]any {
+	out := make(map[string]any, len(doc))
+	for k, v := range doc {
+		switch v := v.(type) {
+		case nil:
+			continue
+		case string:
+			if v == "" {
+				continue
+			}
+		case bool:
+			if !v {
+				continue
+			}
+		case []string:
+			if len(v) == 0 {
+				continue
+			}
+		case map[string]any:
+			nested := compact(v)
+			if len(nested) == 0 {
+				continue
+			}
+			out[k] = nested
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
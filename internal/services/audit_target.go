@@ -0,0 +1,85 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/activity"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/netbird"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/metrics"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+var unknownActivities sync.Map
+
+// auditActivity identifies the activity of an audit event from its
+// activity_code (set by the poller) or its message. Each unknown activity is
+// logged once, so new NetBird activities get noticed and added.
+func auditActivity(ev apicontracts.AuditEventEnvelope) (activity.Activity, bool) {
+	code, _ := ev.Extra["activity_code"].(string)
+	act, known := activity.Lookup(code, ev.Message)
+	if !known {
+		metrics.UnknownActivities.Inc()
+		if _, seen := unknownActivities.LoadOrStore(code+"|"+ev.Message, true); !seen {
+			if candidates := activity.Candidates(ev.Message); code == "" && candidates != nil {
+				logger.Log.Warnf("NetBird audit activity %q without activity code could be any of %v", ev.Message, candidates)
+			} else {
+				logger.Log.Warnf("Unknown NetBird audit activity (code %q, message %q), add it to the activity catalog", code, ev.Message)
+			}
+		}
+	}
+	return act, known
+}
+
+// targetName resolves an audit target ID to a readable name from the cache
+// matching its type, and reports whether that cache is stale. Deleted objects
+// are no longer in the caches, so the name NetBird puts in the event meta is
+// used as a fallback.
+func targetName(targetType activity.TargetType, id string, extra map[string]any) (name string, stale bool) {
+	if id == "" {
+		return "", false
+	}
+
+	switch targetType {
+	case activity.TargetUser:
+		user, _ := netbird.GlobalUserCache.GetUserByID(id)
+		name, stale = firstNonEmpty(user.Name, user.Email), netbird.GlobalUserCache.Stale()
+	case activity.TargetPeer:
+		peer, _ := netbird.GlobalPeerCache.GetPeerByID(id)
+		name, stale = firstNonEmpty(peer.Name, peer.Hostname), netbird.GlobalPeerCache.Stale()
+	case activity.TargetGroup:
+		group, _ := netbird.GlobalGroupCache.GetGroupByID(id)
+		name, stale = group.Name, netbird.GlobalGroupCache.Stale()
+	case activity.TargetPolicy:
+		policy, _ := netbird.GlobalPolicyCache.GetPolicyByID(id)
+		name, stale = policy.Name, netbird.GlobalPolicyCache.Stale()
+	case activity.TargetRule:
+		if _, rule, ok := netbird.GlobalPolicyCache.GetRuleByID(id); ok {
+			name = rule.Name
+		}
+		stale = netbird.GlobalPolicyCache.Stale()
+	case activity.TargetSetupKey:
+		key, _ := netbird.GlobalSetupKeyCache.GetSetupKeyByID(id)
+		name, stale = key.Name, netbird.GlobalSetupKeyCache.Stale()
+	case activity.TargetRoute:
+		route, _ := netbird.GlobalRouteCache.GetRouteByID(id)
+		name, stale = firstNonEmpty(route.NetworkID, route.Description), netbird.GlobalRouteCache.Stale()
+	case activity.TargetNameserverGroup:
+		ns, _ := netbird.GlobalNameserverGroupCache.GetNameserverGroupByID(id)
+		name, stale = ns.Name, netbird.GlobalNameserverGroupCache.Stale()
+	case activity.TargetPostureCheck:
+		check, _ := netbird.GlobalPostureCheckCache.GetPostureCheckByID(id)
+		name, stale = check.Name, netbird.GlobalPostureCheckCache.Stale()
+	case activity.TargetNetwork:
+		network, _ := netbird.GlobalNetworkCache.GetNetworkByID(id)
+		name, stale = network.Name, netbird.GlobalNetworkCache.Stale()
+	case activity.TargetNetworkResource:
+		resource, _ := netbird.GlobalResourceCache.GetResourceByID(id)
+		name, stale = resource.Name, netbird.GlobalResourceCache.Stale()
+	}
+
+	if name == "" {
+		name, _ = extra["name"].(string)
+	}
+	return name, stale
+}
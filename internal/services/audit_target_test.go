@@ -0,0 +1,146 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/activity"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/netbird"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netbirdapi"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	nb "github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/netbird"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// fakeCaches points the caches at a fake API.
+func fakeCaches(t *testing.T) {
+	t.Helper()
+	reply := func(v any) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(v)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/users", reply([]nb.NetbirdUser{{ID: "user-1", Email: "alice@example.com"}, {ID: "user-2", Name: "Bob", Email: "bob@example.com"}}))
+	mux.HandleFunc("/api/peers", reply([]nb.NetbirdPeer{
+		{
+			ID: "peer-1", Name: "laptop-1", Hostname: "laptop-1.local", UserID: "user-1", OS: "Darwin", Version: "0.36.0",
+			CountryCode: "NO", CityName: "Oslo", Groups: []nb.NetbirdGroupMinimum{{ID: "group-1", Name: "Servers"}, {ID: "group-2", Name: "All"}},
+		},
+		{ID: "peer-2", Hostname: "exit-1"},
+		{ID: "peer-3", Hostname: "db-1", UserID: "user-2", OS: "Linux", Version: "0.35.2", CountryCode: "NO", Groups: []nb.NetbirdGroupMinimum{{ID: "group-1", Name: "Servers"}}},
+	}))
+	mux.HandleFunc("/api/networks", reply([]nb.NetbirdNetwork{{ID: "net-1", Name: "prod"}}))
+	mux.HandleFunc("/api/networks/net-1/resources", reply([]nb.NetbirdNetworkResource{{ID: "res-1", Name: "postgres"}}))
+	mux.HandleFunc("/api/routes", reply([]nb.NetbirdRoute{{ID: "route-1", NetworkID: "office-lan"}}))
+	mux.HandleFunc("/api/groups", reply([]nb.NetbirdGroup{{ID: "group-1", Name: "Servers"}}))
+	mux.HandleFunc("/api/policies", reply([]nb.NetbirdPolicy{{ID: "policy-1", Name: "Developers", Rules: []nb.NetbirdPolicyRule{{
+		ID: "rule-1", Name: "ssh", Enabled: true,
+		Sources:      []nb.NetbirdGroupMinimum{{ID: "group-3", Name: "Developers"}},
+		Destinations: []nb.NetbirdGroupMinimum{{ID: "group-1", Name: "Servers"}},
+	}}}}))
+	mux.HandleFunc("/api/dns/nameservers", reply([]nb.NetbirdNameserverGroup{{ID: "ns-1", Name: "Internal DNS"}}))
+	mux.HandleFunc("/api/posture-checks", reply([]nb.NetbirdPostureCheck{{ID: "pc-1", Name: "Min version"}}))
+	mux.HandleFunc("/api/setup-keys", reply([]nb.NetbirdSetupKey{{ID: "key-1", Name: "CI runners"}}))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	client, err := netbirdapi.NewClient("token", netbirdapi.Config{BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, newCache := range []func(*netbirdapi.Client) error{
+		netbird.NewUserCache, netbird.NewPeerCache, netbird.NewGroupCache, netbird.NewPolicyCache,
+		netbird.NewNetworkCache, netbird.NewResourceCache, netbird.NewRouteCache,
+		netbird.NewNameserverGroupCache, netbird.NewPostureCheckCache, netbird.NewSetupKeyCache,
+	} {
+		if err := newCache(client); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTargetName(t *testing.T) {
+	fakeCaches(t)
+	tests := []struct {
+		name   string
+		target activity.TargetType
+		id     string
+		extra  map[string]any
+		want   string
+	}{
+		{"user without name", activity.TargetUser, "user-1", nil, "alice@example.com"},
+		{"user with name", activity.TargetUser, "user-2", nil, "Bob"},
+		{"group", activity.TargetGroup, "group-1", nil, "Servers"},
+		{"policy", activity.TargetPolicy, "policy-1", nil, "Developers"},
+		{"rule", activity.TargetRule, "rule-1", nil, "ssh"},
+		{"peer", activity.TargetPeer, "peer-1", nil, "laptop-1"},
+		{"setup key", activity.TargetSetupKey, "key-1", nil, "CI runners"},
+		{"route", activity.TargetRoute, "route-1", nil, "office-lan"},
+		{"nameserver group", activity.TargetNameserverGroup, "ns-1", nil, "Internal DNS"},
+		{"posture check", activity.TargetPostureCheck, "pc-1", nil, "Min version"},
+		{"network", activity.TargetNetwork, "net-1", nil, "prod"},
+		{"network resource", activity.TargetNetworkResource, "res-1", nil, "postgres"},
+		{"deleted group uses meta name", activity.TargetGroup, "group-9", map[string]any{"name": "Old servers"}, "Old servers"},
+		{"unknown type uses meta name", activity.TargetIntegration, "int-1", map[string]any{"name": "Okta"}, "Okta"},
+		{"no id", activity.TargetUser, "", map[string]any{"name": "x"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := targetName(tt.target, tt.id, tt.extra); got != tt.want {
+				t.Errorf("targetName = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetNameReportsStaleCache(t *testing.T) {
+	fakeCaches(t)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(down.Close)
+	client, err := netbirdapi.NewClient("token", netbirdapi.Config{BaseURL: down.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := netbird.NewGroupCache(client); err == nil {
+		t.Fatal("group cache loaded from an API that is down")
+	}
+
+	// Only the cache the target is resolved from counts.
+	if _, stale := targetName(activity.TargetGroup, "group-1", nil); !stale {
+		t.Error("group target not reported stale")
+	}
+	if _, stale := targetName(activity.TargetUser, "user-1", nil); stale {
+		t.Error("user target reported stale because of the group cache")
+	}
+}
+
+func TestUnknownActivityLoggedOnce(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	prev := logger.Log
+	logger.Log = zap.New(core).Sugar()
+	t.Cleanup(func() { logger.Log = prev })
+
+	known := apicontracts.AuditEventEnvelope{Message: "User blocked"}
+	if act, ok := auditActivity(known); !ok || act.Code != "user.block" {
+		t.Fatalf("auditActivity = %s, %t; want user.block", act.Code, ok)
+	}
+
+	unknown := apicontracts.AuditEventEnvelope{Message: "Peer teleported", Extra: map[string]any{"activity_code": "peer.teleport"}}
+	unknownActivities.Delete("peer.teleport|Peer teleported")
+	for range 3 {
+		if act, ok := auditActivity(unknown); ok || act.Code != "peer.teleport" {
+			t.Fatalf("auditActivity = %s, %t; want unknown peer.teleport", act.Code, ok)
+		}
+	}
+	if n := logs.Len(); n != 1 {
+		t.Errorf("logged %d warnings, want 1", n)
+	}
+}
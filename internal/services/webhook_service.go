@@ -1,78 +1,181 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net"
-	"strconv"
-	"strings"
 
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/activity"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/alerting"
 	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/netbird"
 	"github.com/NorskHelsenett/netbird-log-forwarder/internal/cache/protocols"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/dedup"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/expr"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/fieldset"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/filter"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/flows"
 	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/nat"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/netaddr"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/sinks"
 	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
-	"github.com/go-playground/validator/v10"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
-func ProcessTrafficEvent(request apicontracts.TrafficEvent) (any, error) {
+// ErrFiltered is returned for events dropped by the filter rules or an
+// expression filter.
+var ErrFiltered = errors.New("event filtered")
+
+func ProcessTrafficEvent(ctx context.Context, request apicontracts.TrafficEvent) (any, error) {
 
 	if !SplunktWorthy(request) {
-		return nil, fmt.Errorf("not_splunk_worthy")
+		return nil, ErrFiltered
+	}
+
+	keep, fields := expr.EvaluateTraffic(request)
+	if !keep {
+		return nil, ErrFiltered
 	}
 
 	sourcePeer, _ := netbird.GlobalPeerCache.GetPeerByID(request.Meta.SourceID)
 	userId := sourcePeer.UserID
 
 	user, _ := netbird.GlobalUserCache.GetUserByID(userId)
-	unixTime := float64(request.Timestamp.UnixNano()) / 1e9
-	srcIp := strings.Split(request.Meta.SourceAddr, ":")[0]
-	srcPort := strings.Split(request.Meta.SourceAddr, ":")[1]
-	srcPortInt, _ := strconv.Atoi(srcPort)
-	dstIp := strings.Split(request.Meta.DestinationAddr, ":")[0]
-	dstPort := strings.Split(request.Meta.DestinationAddr, ":")[1]
-	dstPortInt, _ := strconv.Atoi(dstPort)
+	srcIp := netaddr.Host(request.Meta.SourceAddr)
+	_, srcPortInt := netaddr.Split(request.Meta.SourceAddr)
+	dstIp := netaddr.Host(request.Meta.DestinationAddr)
+	dstAddr, dstPortInt := netaddr.Split(request.Meta.DestinationAddr)
 	sourceName := request.Meta.SourceName
 
 	exitNode, _ := netbird.GlobalPeerCache.GetPeerByID(request.Meta.ReporterID)
 
-	xlateMap := viper.GetStringMapString("xlate")
-	xlateIp := xlateMap[exitNode.Hostname]
-	if xlateIp != "" {
-		srcIp = xlateIp
+	var srcTranslatedIp string
+	if translated, _, ok := nat.Translate(nat.Flow{
+		ExitNode:   exitNode.Hostname,
+		PeerGroups: sourcePeer.GroupNames(),
+		DstIP:      dstAddr,
+		DstPort:    dstPortInt,
+	}); ok {
+		srcTranslatedIp = translated.String()
 	}
 
 	splunkEvent := apicontracts.SplunkTrafficEvent{
-		Time:       unixTime,
 		Protocol:   protocols.ProtocolsMap[request.Meta.Protocol],
-		SrcIP:      srcIp, // xlate
-		SrcPort:    srcPortInt,
+		SrcIP:      srcIp,
+		SrcPort:    max(srcPortInt, 0),
 		SourceName: sourceName,
 		Email:      user.Email,
 		DstIP:      dstIp,
-		DstPort:    dstPortInt,
+		DstPort:    max(dstPortInt, 0),
 		ExitNode:   exitNode.Hostname,
 		Message:    request.Message,
+		CacheStale: netbird.GlobalPeerCache.Stale() || netbird.GlobalUserCache.Stale(),
+		Fields:     fields,
+
+		SrcTranslatedIP: srcTranslatedIp,
+
+		SrcGroups:  sourcePeer.GroupNames(),
+		SrcOS:      sourcePeer.OS,
+		SrcVersion: sourcePeer.Version,
+		SrcCountry: firstNonEmpty(sourcePeer.CountryCode, request.Meta.SourceGeoCountry),
+		SrcCity:    firstNonEmpty(sourcePeer.CityName, request.Meta.SourceGeoCity),
+		DstCountry: request.Meta.DestinationGeoCountry,
+		DstCity:    request.Meta.DestinationGeoCity,
+
+		PolicyID:    request.Meta.PolicyID,
+		FlowID:      request.Meta.FlowID,
+		Direction:   request.Meta.Direction,
+		ReporterID:  request.Meta.ReporterID,
+		SrcID:       request.Meta.SourceID,
+		SrcType:     request.Meta.SourceType,
+		SrcDNSLabel: request.Meta.SourceDNSLabel,
+		DstID:       request.Meta.DestinationID,
+		DstType:     request.Meta.DestinationType,
+		DstName:     request.Meta.DestinationName,
+		DstDNSLabel: request.Meta.DestinationDNSLabel,
+		RxBytes:     request.Meta.RxBytes,
+		TxBytes:     request.Meta.TxBytes,
+		RxPackets:   request.Meta.RxPackets,
+		TxPackets:   request.Meta.TxPackets,
+		ReceivedAt:  request.Meta.ReceivedTimestamp,
+		FieldSet:    fieldset.Traffic(),
+	}
+
+	if p := request.Meta.Protocol; p == 1 || p == 58 { // icmp, ipv6-icmp
+		icmpType, icmpCode := request.Meta.ICMPType, request.Meta.ICMPCode
+		splunkEvent.ICMPType, splunkEvent.ICMPCode = &icmpType, &icmpCode
+	}
+
+	if request.Meta.PolicyID != "" {
+		splunkEvent.PolicyName = request.Meta.PolicyName
+		splunkEvent.PolicySrcGroups, splunkEvent.PolicyDstGroups = netbird.GlobalPolicyCache.PolicyGroups(request.Meta.PolicyID)
+		splunkEvent.CacheStale = splunkEvent.CacheStale || netbird.GlobalPolicyCache.Stale()
 	}
 
-	logger.SplunkTraffic.Infow(
-		request.Message,
-		"time", splunkEvent.Time,
-		"protocol", splunkEvent.Protocol,
-		"src_ip", splunkEvent.SrcIP,
-		"src_port", splunkEvent.SrcPort,
-		"source_name", splunkEvent.SourceName,
-		"email", splunkEvent.Email,
-		"dst_ip", splunkEvent.DstIP,
-		"dst_port", splunkEvent.DstPort,
-		"exit_node", splunkEvent.ExitNode,
-	)
+	switch {
+	case request.Meta.DestinationID == "":
+	case request.Meta.DestinationType == "PEER":
+		destPeer, _ := netbird.GlobalPeerCache.GetPeerByID(request.Meta.DestinationID)
+		splunkEvent.DstHostname = destPeer.Hostname
+		splunkEvent.DstGroups = destPeer.GroupNames()
+		splunkEvent.DstOS = destPeer.OS
+		splunkEvent.DstVersion = destPeer.Version
+		splunkEvent.DstCountry = firstNonEmpty(destPeer.CountryCode, splunkEvent.DstCountry)
+		splunkEvent.DstCity = firstNonEmpty(destPeer.CityName, splunkEvent.DstCity)
+
+		if destPeer.UserID != "" {
+			destUser, _ := netbird.GlobalUserCache.GetUserByID(destPeer.UserID)
+			splunkEvent.DstEmail = destUser.Email
+			splunkEvent.DstUser = destUser.Name
+		}
+	default:
+		splunkEvent.CacheStale = splunkEvent.CacheStale || netbird.GlobalResourceCache.Stale() || netbird.GlobalRouteCache.Stale()
+		if resource, err := netbird.GlobalResourceCache.GetResourceByID(request.Meta.DestinationID); err == nil {
+			splunkEvent.DstResource = resource.Name
+			splunkEvent.DstNetwork = resource.NetworkName
+		} else if route, err := netbird.GlobalRouteCache.GetRouteByID(request.Meta.DestinationID); err == nil {
+			splunkEvent.DstResource = route.NetworkID // rutens navn i NetBird
+		}
+	}
+
+	forward := func(ctx context.Context) error {
+		return forwardTraffic(ctx, request, splunkEvent)
+	}
+	if dedup.GlobalDeduper != nil {
+		splunkEvent.ReportedBy = exitNode.Hostname
+		if err := dedup.GlobalDeduper.Process(ctx, request, exitNode.Hostname, forward); err != nil {
+			return nil, err
+		}
+		return request, nil
+	}
+	if err := forward(ctx); err != nil {
+		return nil, err
+	}
 
 	return request, nil
 
 }
 
-func ProcessAuditEvent(ev apicontracts.AuditEventEnvelope) (any, error) {
+// forwardTraffic hands a traffic event that survived filtering and
+// de-duplication to the flow aggregator and the sinks.
+func forwardTraffic(ctx context.Context, request apicontracts.TrafficEvent, splunkEvent apicontracts.SplunkTrafficEvent) error {
+	if flows.GlobalAggregator != nil {
+		flows.GlobalAggregator.Observe(request, splunkEvent)
+	}
+	if flows.EmitRaw() {
+		if err := sinks.GlobalSinks.Send(ctx, sinks.TrafficEvent(request.Timestamp, splunkEvent)); err != nil {
+			return fmt.Errorf("forward traffic event: %w", err)
+		}
+	}
+	return nil
+}
+
+func ProcessAuditEvent(ctx context.Context, ev apicontracts.AuditEventEnvelope) (any, error) {
+
+	keep, fields := expr.EvaluateAudit(ev)
+	if !keep {
+		return nil, ErrFiltered
+	}
 
 	initator := ev.InitiatorID
 	target := ev.TargetID
@@ -82,76 +185,80 @@ func ProcessAuditEvent(ev apicontracts.AuditEventEnvelope) (any, error) {
 		initator = netbirdInitiatorUser.Name
 	}
 
-	netbirdTargetUser, _ := netbird.GlobalUserCache.GetUserByID(ev.TargetID)
-	if netbirdTargetUser.Name != "" {
-		target = netbirdTargetUser.Name
-	}
+	act, known := auditActivity(ev)
+	resolvedTarget, targetStale := targetName(act.Target, ev.TargetID, ev.Extra)
 
-	unixTime := float64(ev.Timestamp.UnixNano()) / 1e9
+	// target_id har historisk fått brukernavnet; behold det for brukere
+	if act.Target == activity.TargetUser || act.Target == activity.TargetUnknown {
+		netbirdTargetUser, _ := netbird.GlobalUserCache.GetUserByID(ev.TargetID)
+		if netbirdTargetUser.Name != "" {
+			target = netbirdTargetUser.Name
+		}
+	}
 
-	fields := []any{
-		zap.Float64("time", unixTime),
-		zap.String("message", ev.Message),
-		zap.String("initiator_id", initator),
-		zap.String("target_id", target),
-		zap.ByteString("raw_event", ev.Raw),
+	extra := ev.Extra
+	if len(fields) > 0 {
+		extra = make(map[string]any, len(ev.Extra)+len(fields))
+		for k, v := range ev.Extra {
+			extra[k] = v
+		}
+		for k, v := range fields {
+			extra[k] = v
+		}
 	}
-	for k, v := range ev.Extra {
-		fields = append(fields, zap.Any(k, v))
+
+	splunkEvent := apicontracts.SplunkAuditEvent{
+		Message:     ev.Message,
+		InitiatorID: initator,
+		TargetID:    target,
+		RawEvent:    string(ev.Raw),
+		TargetType:  string(act.Target),
+		TargetName:  resolvedTarget,
+		CacheStale:  netbird.GlobalUserCache.Stale() || targetStale,
+
+		ActivityCode:     act.Code,
+		ActivityCategory: string(act.Category),
+		ActivityAction:   act.Action,
+		ActivitySeverity: string(act.Severity),
+		ActivityUnknown:  !known,
+		Extra:            extra,
 	}
 
-	logger.SplunkAudit.Infow(
-		ev.Message,
-		fields...,
-	)
+	alerting.Evaluate(splunkEvent, ev.Timestamp)
+
+	if err := sinks.GlobalSinks.Send(ctx, sinks.AuditEvent(ev.Timestamp, splunkEvent)); err != nil {
+		return nil, fmt.Errorf("forward audit event: %w", err)
+	}
 
 	return ev, nil
 
 }
 
-func ValidateRequest(request *apicontracts.TrafficEvent) error {
-	validate := validator.New(validator.WithRequiredStructEnabled())
-	err := validate.Struct(*request)
-
-	if err != nil {
-		return err
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
 	}
-
-	return nil
+	return ""
 }
 
 func SplunktWorthy(request apicontracts.TrafficEvent) bool {
-	meta := request.Meta
 	baselogger := logger.Log.Desugar()
 
-	if meta.DestinationName != "" && meta.Direction == "INGRESS" && meta.DestinationType == "PEER" {
-		// if meta.DestinationName != "" && (meta.Direction == "INGRESS" || meta.Direction == "EGRESS") && meta.DestinationType == "PEER" {
-		ipString, _, err := net.SplitHostPort(meta.DestinationAddr)
-		if err != nil {
-			logger.Log.Warnf("Failed to split host and port: %v", err)
-		}
-
-		ip := net.ParseIP(ipString)
-		if ip == nil {
-			logger.Log.Warnf("Invalid IP address: %s", ipString)
-		}
+	action, rule := filter.Evaluate(request, func() string {
+		sourcePeer, _ := netbird.GlobalPeerCache.GetPeerByID(request.Meta.SourceID)
+		user, _ := netbird.GlobalUserCache.GetUserByID(sourcePeer.UserID)
+		return user.Email
+	})
 
-		_, network, err := net.ParseCIDR("100.110.0.0/16")
-		if err != nil {
-			logger.Log.Errorf("Failed to parse CIDR: %v", err)
-		}
-
-		if network.Contains(ip) {
-			// logger.Log.Infoln("--- Traffic event rejected ---")
-			// baselogger.Info("incoming_event", zap.Any("event", request))
-			return false
-		}
-		logger.Log.Infoln("--- Traffic event accepted ---")
+	if action == filter.Include {
+		logger.Log.Infof("--- Traffic event accepted (rule %s) ---", rule)
 		baselogger.Info("incoming_event", zap.Any("event", request))
 		return true
 	}
 
-	logger.Log.Infoln("--- Traffic event rejected ---")
+	logger.Log.Infof("--- Traffic event rejected (rule %s) ---", rule)
 	baselogger.Info("incoming_event", zap.Any("event", request))
 	return false
 }
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/filter"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/sinks"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/spf13/viper"
+)
+
+// captureSink keeps the traffic events handed to the sinks.
+type captureSink struct {
+	traffic []apicontracts.SplunkTrafficEvent
+}
+
+func (c *captureSink) Name() string { return "capture" }
+
+func (c *captureSink) Send(_ context.Context, event sinks.Event) error {
+	if event.Traffic != nil {
+		c.traffic = append(c.traffic, *event.Traffic)
+	}
+	return nil
+}
+
+func (c *captureSink) Flush(context.Context) error { return nil }
+func (c *captureSink) Close() error                { return nil }
+
+// forwardAll lets every traffic event through the filter and captures what
+// reaches the sinks.
+func forwardAll(t *testing.T) *captureSink {
+	t.Helper()
+	viper.Set("filter", map[string]any{"default_action": "include"})
+	t.Cleanup(func() { viper.Set("filter", nil) })
+	if err := filter.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	capture := &captureSink{}
+	prev := sinks.GlobalSinks
+	sinks.GlobalSinks = sinks.NewMultiSink(capture)
+	t.Cleanup(func() { sinks.GlobalSinks = prev })
+	return capture
+}
+
+func processTraffic(t *testing.T, capture *captureSink, meta apicontracts.TrafficMeta) apicontracts.SplunkTrafficEvent {
+	t.Helper()
+	capture.traffic = nil
+	if _, err := ProcessTrafficEvent(context.Background(), apicontracts.TrafficEvent{ID: "ev-1", Message: "TYPE_START", Meta: meta}); err != nil {
+		t.Fatal(err)
+	}
+	if len(capture.traffic) != 1 {
+		t.Fatalf("forwarded %d events, want 1", len(capture.traffic))
+	}
+	return capture.traffic[0]
+}
+
+func TestTrafficSourceEnrichment(t *testing.T) {
+	fakeCaches(t)
+	capture := forwardAll(t)
+
+	tests := []struct {
+		name        string
+		meta        apicontracts.TrafficMeta
+		wantGroups  []string
+		wantOS      string
+		wantVersion string
+		wantCountry string
+		wantCity    string
+		wantEmail   string
+	}{
+		{
+			name:        "known peer",
+			meta:        apicontracts.TrafficMeta{SourceID: "peer-1", SourceAddr: "100.64.0.1:51234", ReporterID: "peer-2", SourceGeoCountry: "SE", SourceGeoCity: "Stockholm"},
+			wantGroups:  []string{"Servers", "All"},
+			wantOS:      "Darwin",
+			wantVersion: "0.36.0",
+			wantCountry: "NO",
+			wantCity:    "Oslo",
+			wantEmail:   "alice@example.com",
+		},
+		{
+			name:        "unknown peer falls back to flow geo",
+			meta:        apicontracts.TrafficMeta{SourceID: "peer-9", SourceAddr: "100.64.0.9:51234", ReporterID: "peer-2", SourceGeoCountry: "SE", SourceGeoCity: "Stockholm"},
+			wantGroups:  []string{},
+			wantCountry: "SE",
+			wantCity:    "Stockholm",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := processTraffic(t, capture, tt.meta)
+			if !slices.Equal(ev.SrcGroups, tt.wantGroups) {
+				t.Errorf("SrcGroups = %v, want %v", ev.SrcGroups, tt.wantGroups)
+			}
+			if ev.SrcOS != tt.wantOS || ev.SrcVersion != tt.wantVersion {
+				t.Errorf("OS and version = %q %q, want %q %q", ev.SrcOS, ev.SrcVersion, tt.wantOS, tt.wantVersion)
+			}
+			if ev.SrcCountry != tt.wantCountry || ev.SrcCity != tt.wantCity {
+				t.Errorf("location = %q %q, want %q %q", ev.SrcCountry, ev.SrcCity, tt.wantCountry, tt.wantCity)
+			}
+			if ev.Email != tt.wantEmail || ev.ExitNode != "exit-1" {
+				t.Errorf("email %q exit node %q", ev.Email, ev.ExitNode)
+			}
+		})
+	}
+}
+
+func TestTrafficDestinationEnrichment(t *testing.T) {
+	fakeCaches(t)
+	capture := forwardAll(t)
+
+	tests := []struct {
+		name string
+		meta apicontracts.TrafficMeta
+		want apicontracts.SplunkTrafficEvent
+	}{
+		{
+			name: "peer with user",
+			meta: apicontracts.TrafficMeta{DestinationID: "peer-3", DestinationType: "PEER", DestinationGeoCountry: "SE"},
+			want: apicontracts.SplunkTrafficEvent{DstHostname: "db-1", DstEmail: "bob@example.com", DstUser: "Bob", DstOS: "Linux", DstVersion: "0.35.2", DstCountry: "NO", DstGroups: []string{"Servers"}},
+		},
+		{
+			name: "network resource",
+			meta: apicontracts.TrafficMeta{DestinationID: "res-1", DestinationType: "HOST_RESOURCE"},
+			want: apicontracts.SplunkTrafficEvent{DstResource: "postgres", DstNetwork: "prod"},
+		},
+		{
+			name: "route",
+			meta: apicontracts.TrafficMeta{DestinationID: "route-1", DestinationType: "ROUTE"},
+			want: apicontracts.SplunkTrafficEvent{DstResource: "office-lan"},
+		},
+		{
+			name: "unknown peer",
+			meta: apicontracts.TrafficMeta{DestinationID: "peer-9", DestinationType: "PEER", DestinationGeoCountry: "SE"},
+			want: apicontracts.SplunkTrafficEvent{DstCountry: "SE"},
+		},
+		{
+			name: "no destination id",
+			meta: apicontracts.TrafficMeta{DestinationType: "PEER"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.meta.SourceID, tt.meta.ReporterID = "peer-1", "peer-2"
+			ev := processTraffic(t, capture, tt.meta)
+			if ev.DstHostname != tt.want.DstHostname || ev.DstEmail != tt.want.DstEmail || ev.DstUser != tt.want.DstUser {
+				t.Errorf("peer = %q %q %q, want %q %q %q", ev.DstHostname, ev.DstEmail, ev.DstUser, tt.want.DstHostname, tt.want.DstEmail, tt.want.DstUser)
+			}
+			if ev.DstOS != tt.want.DstOS || ev.DstVersion != tt.want.DstVersion || ev.DstCountry != tt.want.DstCountry || !slices.Equal(ev.DstGroups, tt.want.DstGroups) {
+				t.Errorf("peer details = %q %q %q %v", ev.DstOS, ev.DstVersion, ev.DstCountry, ev.DstGroups)
+			}
+			if ev.DstResource != tt.want.DstResource || ev.DstNetwork != tt.want.DstNetwork {
+				t.Errorf("resource = %q in %q, want %q in %q", ev.DstResource, ev.DstNetwork, tt.want.DstResource, tt.want.DstNetwork)
+			}
+		})
+	}
+}
+
+func TestTrafficPolicyGroups(t *testing.T) {
+	fakeCaches(t)
+	capture := forwardAll(t)
+
+	ev := processTraffic(t, capture, apicontracts.TrafficMeta{SourceID: "peer-1", ReporterID: "peer-2", PolicyID: "policy-1", PolicyName: "Developers"})
+	if !slices.Equal(ev.PolicySrcGroups, []string{"Developers"}) || !slices.Equal(ev.PolicyDstGroups, []string{"Servers"}) {
+		t.Errorf("policy groups = %v -> %v", ev.PolicySrcGroups, ev.PolicyDstGroups)
+	}
+
+	ev = processTraffic(t, capture, apicontracts.TrafficMeta{SourceID: "peer-1", ReporterID: "peer-2", PolicyID: "policy-9"})
+	if ev.PolicySrcGroups != nil || ev.PolicyDstGroups != nil {
+		t.Errorf("unknown policy has groups %v -> %v", ev.PolicySrcGroups, ev.PolicyDstGroups)
+	}
+}
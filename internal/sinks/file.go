@@ -0,0 +1,116 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/schema"
+	"github.com/spf13/viper"
+)
+
+// FileConfig is one entry of the files list in config.yaml.
+type FileConfig struct {
+	Name    string `mapstructure:"name"`
+	Path    string `mapstructure:"path"`
+	Profile string `mapstructure:"profile"`
+	// Kinds limits the file to these event kinds. Empty writes all.
+	Kinds []Kind `mapstructure:"kinds"`
+}
+
+// FileSink appends one JSON document per line to a file, e.g. for Filebeat
+// or another shipper to pick up in the schema it expects.
+type FileSink struct {
+	name    string
+	profile schema.Mapper
+	kinds   map[Kind]bool
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func NewFileSink(cfg FileConfig) (*FileSink, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("no path")
+	}
+	profile, err := schema.Lookup(cfg.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o750); err != nil {
+		return nil, fmt.Errorf("create dir: %w", err)
+	}
+	f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", cfg.Path, err)
+	}
+
+	s := &FileSink{
+		name:    "file:" + cfg.Name,
+		profile: profile,
+		file:    f,
+		enc:     json.NewEncoder(f),
+	}
+	if cfg.Name == "" {
+		s.name = "file:" + cfg.Path
+	}
+	if len(cfg.Kinds) > 0 {
+		s.kinds = make(map[Kind]bool, len(cfg.Kinds))
+		for _, k := range cfg.Kinds {
+			s.kinds[k] = true
+		}
+	}
+	return s, nil
+}
+
+// NewFileSinksFromConfig builds a FileSink for every entry under files.
+func NewFileSinksFromConfig() ([]Sink, error) {
+	var cfgs []FileConfig
+	if err := viper.UnmarshalKey("files", &cfgs); err != nil {
+		return nil, fmt.Errorf("decode files config: %w", err)
+	}
+	var sinks []Sink
+	for i, cfg := range cfgs {
+		s, err := NewFileSink(cfg)
+		if err != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("files[%d]: %w", i, err)
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, nil
+}
+
+func (s *FileSink) Name() string {
+	return s.name
+}
+
+func (s *FileSink) Send(ctx context.Context, event Event) error {
+	if s.kinds != nil && !s.kinds[event.Kind] {
+		return nil
+	}
+	doc, err := event.Render(s.profile)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(doc)
+}
+
+func (s *FileSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
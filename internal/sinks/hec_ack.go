@@ -0,0 +1,233 @@
+package sinks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+)
+
+type AckConfig struct {
+	Enabled      bool
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxInFlight  int
+}
+
+func (c AckConfig) withDefaults() AckConfig {
+	if c.PollInterval <= 0 {
+		c.PollInterval = 5 * time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 2 * time.Minute
+	}
+	if c.MaxInFlight <= 0 {
+		c.MaxInFlight = 100
+	}
+	return c
+}
+
+type inFlightBatch struct {
+	body   []byte
+	events int
+	sentAt time.Time
+	// acked is set for batches replayed from the spool. They stay in the
+	// spool until the outcome is reported here, and are never resent or
+	// spooled again by the tracker.
+	acked chan<- error
+}
+
+var errNotAcked = errors.New("not acknowledged by the indexers")
+
+// ackTracker holds batches HEC has accepted until the indexers confirm them
+// through /services/collector/ack. Batches not confirmed within Timeout are
+// sent again, or handed back to the replay loop if they came from the spool.
+type ackTracker struct {
+	b       *hecBatcher
+	cfg     AckConfig
+	channel string
+
+	mu      sync.Mutex
+	pending map[int64]inFlightBatch
+	slots   chan struct{}
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type hecAckRequest struct {
+	Acks []int64 `json:"acks"`
+}
+
+type hecAckResponse struct {
+	Acks map[string]bool `json:"acks"`
+}
+
+func newAckTracker(b *hecBatcher, cfg AckConfig) *ackTracker {
+	cfg = cfg.withDefaults()
+	t := &ackTracker{
+		b:       b,
+		cfg:     cfg,
+		channel: newChannelID(),
+		pending: make(map[int64]inFlightBatch),
+		slots:   make(chan struct{}, cfg.MaxInFlight),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go t.pollLoop()
+	return t
+}
+
+// newChannelID returns a random UUIDv4, which is the format HEC expects for
+// X-Splunk-Request-Channel.
+func newChannelID() string {
+	var u [16]byte
+	_, _ = rand.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// acquire reserves an in-flight slot, blocking while the buffer is full.
+func (t *ackTracker) acquire() {
+	t.slots <- struct{}{}
+}
+
+func (t *ackTracker) release() {
+	<-t.slots
+}
+
+func (t *ackTracker) track(ackID int64, body []byte, events int, acked chan<- error) {
+	t.mu.Lock()
+	t.pending[ackID] = inFlightBatch{body: body, events: events, sentAt: time.Now(), acked: acked}
+	t.mu.Unlock()
+}
+
+func (t *ackTracker) pollLoop() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.poll()
+			t.resendExpired()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+func (t *ackTracker) poll() {
+	t.mu.Lock()
+	ids := make([]int64, 0, len(t.pending))
+	for id := range t.pending {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+
+	resp, err := t.b.client.R().
+		SetHeader("Authorization", "Splunk "+t.b.token).
+		SetHeader("X-Splunk-Request-Channel", t.channel).
+		SetBody(hecAckRequest{Acks: ids}).
+		Post(t.b.url + "/services/collector/ack")
+	if err != nil {
+		logger.Log.Warnf("HEC ack poll failed: %v", err)
+		return
+	}
+	if resp.IsError() {
+		logger.Log.Warnf("HEC ack poll failed: %s: %s", resp.Status(), resp.String())
+		return
+	}
+
+	var result hecAckResponse
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		logger.Log.Warnf("HEC ack poll returned invalid JSON: %v", err)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, ok := range result.Acks {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || !ok {
+			continue
+		}
+		if batch, exists := t.pending[id]; exists {
+			delete(t.pending, id)
+			t.release()
+			if batch.acked != nil {
+				batch.acked <- nil
+			}
+		}
+	}
+}
+
+// resendExpired posts batches that were never acknowledged again under a new
+// ack ID. A batch keeps its slot while being resent.
+func (t *ackTracker) resendExpired() {
+	now := time.Now()
+	expired := make(map[int64]inFlightBatch)
+
+	t.mu.Lock()
+	for id, batch := range t.pending {
+		if now.Sub(batch.sentAt) >= t.cfg.Timeout {
+			expired[id] = batch
+			delete(t.pending, id)
+		}
+	}
+	t.mu.Unlock()
+
+	for id, batch := range expired {
+		if batch.acked != nil {
+			// Still at the head of the spool, the replay loop sends it again.
+			logger.Log.Warnf("No HEC ack for ackId %d after %s, replaying from spool", id, t.cfg.Timeout)
+			t.release()
+			batch.acked <- errNotAcked
+			continue
+		}
+		logger.Log.Warnf("No HEC ack for ackId %d after %s, resending", id, t.cfg.Timeout)
+		ackID, err := t.b.post(context.Background(), batch.body)
+		if err != nil {
+			t.release()
+			t.b.fallback(batch.body, batch.events, err)
+			continue
+		}
+		t.track(ackID, batch.body, batch.events, nil)
+	}
+}
+
+// close stops polling after one last attempt and hands whatever is still
+// unacknowledged to the batcher's fallback, so it ends up in the spool.
+// Batches replayed from the spool are already there.
+func (t *ackTracker) close() {
+	close(t.stop)
+	<-t.done
+	t.poll()
+
+	t.mu.Lock()
+	remaining := t.pending
+	t.pending = make(map[int64]inFlightBatch)
+	t.mu.Unlock()
+
+	for range remaining {
+		t.release()
+	}
+	for _, batch := range remaining {
+		if batch.acked != nil {
+			batch.acked <- errNotAcked
+			continue
+		}
+		t.b.fallback(batch.body, batch.events, fmt.Errorf("not acknowledged before shutdown"))
+	}
+}
@@ -0,0 +1,192 @@
+package sinks
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/spool"
+	"github.com/go-resty/resty/v2"
+)
+
+// fakeHEC stands in for a HEC endpoint with indexer acknowledgement. acked
+// decides whether an ack ID is reported as indexed when polled.
+type fakeHEC struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	posts [][]byte
+	next  int64
+	acked func(id int64) bool
+}
+
+func newFakeHEC(t testing.TB, acked func(id int64) bool) *fakeHEC {
+	f := &fakeHEC{acked: acked}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeHEC) handle(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/services/collector/event":
+		f.mu.Lock()
+		f.posts = append(f.posts, b)
+		id := f.next
+		f.next++
+		f.mu.Unlock()
+		if r.Header.Get("X-Splunk-Request-Channel") == "" {
+			fmt.Fprint(w, `{"text":"Success","code":0}`)
+			return
+		}
+		fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, id)
+
+	case "/services/collector/ack":
+		var req hecAckRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := hecAckResponse{Acks: make(map[string]bool)}
+		for _, id := range req.Acks {
+			resp.Acks[fmt.Sprint(id)] = f.acked(id)
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeHEC) postCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.posts)
+}
+
+func (f *fakeHEC) post(i int) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return string(f.posts[i])
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestBatcher(t *testing.T, hec *fakeHEC, sp *spool.Spool, ack AckConfig) *hecBatcher {
+	t.Helper()
+	ack.Enabled = true
+	if ack.PollInterval == 0 {
+		ack.PollInterval = 10 * time.Millisecond
+	}
+	b := newHECBatcher(hec.URL, "token", resty.New(), BatchConfig{FlushInterval: time.Hour}, sp, time.Second, ack)
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func spoolWith(t *testing.T, records ...string) *spool.Spool {
+	t.Helper()
+	sp, err := spool.Open(spool.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if err := sp.Append([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sp
+}
+
+func TestReplayKeepsRecordUntilAcked(t *testing.T) {
+	var mu sync.Mutex
+	indexed := false
+	hec := newFakeHEC(t, func(int64) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return indexed
+	})
+	sp := spoolWith(t, `{"event":"a"}`)
+	newTestBatcher(t, hec, sp, AckConfig{Timeout: time.Minute})
+
+	waitFor(t, "replayed record to be posted", func() bool { return hec.postCount() == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if sp.Empty() {
+		t.Fatal("record removed from spool before the indexers acknowledged it")
+	}
+
+	mu.Lock()
+	indexed = true
+	mu.Unlock()
+	waitFor(t, "spool to drain after ack", sp.Empty)
+	if n := hec.postCount(); n != 1 {
+		t.Errorf("record posted %d times, want 1", n)
+	}
+}
+
+func TestReplayResendsLostAck(t *testing.T) {
+	// The first ack ID is never confirmed.
+	hec := newFakeHEC(t, func(id int64) bool { return id != 0 })
+	sp := spoolWith(t, `{"event":"a"}`, `{"event":"b"}`)
+	newTestBatcher(t, hec, sp, AckConfig{Timeout: 50 * time.Millisecond})
+
+	waitFor(t, "spool to drain", sp.Empty)
+	want := []string{`{"event":"a"}`, `{"event":"a"}`, `{"event":"b"}`}
+	if n := hec.postCount(); n != len(want) {
+		t.Fatalf("got %d posts, want %d", n, len(want))
+	}
+	for i, w := range want {
+		if got := hec.post(i); got != w {
+			t.Errorf("post %d = %s, want %s", i, got, w)
+		}
+	}
+}
+
+func TestLiveBatchResentOnLostAck(t *testing.T) {
+	hec := newFakeHEC(t, func(id int64) bool { return id != 0 })
+	b := newTestBatcher(t, hec, nil, AckConfig{Timeout: 50 * time.Millisecond})
+
+	if err := b.Add([]byte(`{"event":"live"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Flush(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "batch to be acknowledged", func() bool {
+		b.acks.mu.Lock()
+		defer b.acks.mu.Unlock()
+		return hec.postCount() == 2 && len(b.acks.pending) == 0
+	})
+	if got := hec.post(1); got != `{"event":"live"}` {
+		t.Errorf("resent %s", got)
+	}
+}
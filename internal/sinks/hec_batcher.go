@@ -0,0 +1,367 @@
+package sinks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/spool"
+	"github.com/go-resty/resty/v2"
+)
+
+type BatchConfig struct {
+	MaxEvents     int
+	MaxBytes      int
+	FlushInterval time.Duration
+	Gzip          bool
+}
+
+func (c BatchConfig) withDefaults() BatchConfig {
+	if c.MaxEvents <= 0 {
+		c.MaxEvents = 100
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = 1 << 20
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = 2 * time.Second
+	}
+	return c
+}
+
+// hecBatch is a set of concatenated HEC event objects sharing one token.
+type hecBatch struct {
+	body   []byte
+	events int
+	done   chan error // non-nil for explicit flushes
+}
+
+// hecBatcher concatenates events for one HEC token and posts them from a
+// single background goroutine, so batches are delivered in order. With a
+// spool, failed batches are written to disk and replayed in order before
+// any new batch is posted.
+type hecBatcher struct {
+	url    string
+	token  string
+	client *resty.Client
+	cfg    BatchConfig
+	spool  *spool.Spool
+
+	maxBackoff time.Duration
+	wake       chan struct{}
+	acks       *ackTracker
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	events int
+	closed bool
+
+	out  chan hecBatch
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newHECBatcher(url, token string, client *resty.Client, cfg BatchConfig, sp *spool.Spool, maxBackoff time.Duration, ack AckConfig) *hecBatcher {
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Minute
+	}
+	b := &hecBatcher{
+		url:        url,
+		token:      token,
+		client:     client,
+		cfg:        cfg.withDefaults(),
+		spool:      sp,
+		maxBackoff: maxBackoff,
+		wake:       make(chan struct{}, 1),
+		out:        make(chan hecBatch, 4),
+		stop:       make(chan struct{}),
+	}
+	if ack.Enabled {
+		b.acks = newAckTracker(b, ack)
+	}
+	b.wg.Add(2)
+	go b.sendLoop()
+	go b.tickLoop()
+	if sp != nil {
+		b.wg.Add(1)
+		go b.replayLoop()
+	}
+	return b
+}
+
+// Add appends one encoded HEC event. It blocks only when the outbound queue
+// is full, which pushes back on the caller while HEC is slow.
+func (b *hecBatcher) Add(event []byte) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return fmt.Errorf("hec batcher closed")
+	}
+	if b.events > 0 && b.buf.Len()+len(event) > b.cfg.MaxBytes {
+		b.enqueueLocked(nil)
+	}
+	b.buf.Write(event)
+	b.events++
+	if b.events >= b.cfg.MaxEvents || b.buf.Len() >= b.cfg.MaxBytes {
+		b.enqueueLocked(nil)
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// enqueueLocked hands the current buffer to the send loop. Caller holds mu.
+func (b *hecBatcher) enqueueLocked(done chan error) {
+	batch := hecBatch{done: done}
+	if b.events > 0 {
+		batch.body = bytes.Clone(b.buf.Bytes())
+		batch.events = b.events
+		b.buf.Reset()
+		b.events = 0
+	}
+	if batch.events == 0 && done == nil {
+		return
+	}
+	b.out <- batch
+}
+
+// Flush sends everything buffered so far and waits until it has been posted.
+func (b *hecBatcher) Flush(ctx context.Context) error {
+	done := make(chan error, 1)
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.enqueueLocked(done)
+	b.mu.Unlock()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *hecBatcher) Close() error {
+	done := make(chan error, 1)
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.enqueueLocked(done)
+	b.closed = true
+	b.mu.Unlock()
+
+	err := <-done
+	close(b.stop)
+	close(b.out)
+	b.wg.Wait()
+	if b.acks != nil {
+		b.acks.close()
+	}
+	if b.spool != nil {
+		err = errors.Join(err, b.spool.Close())
+	}
+	return err
+}
+
+func (b *hecBatcher) tickLoop() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.mu.Lock()
+			if !b.closed {
+				b.enqueueLocked(nil)
+			}
+			b.mu.Unlock()
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+func (b *hecBatcher) sendLoop() {
+	defer b.wg.Done()
+	for batch := range b.out {
+		var err error
+		if batch.events > 0 {
+			err = b.deliver(batch)
+		}
+		if batch.done != nil {
+			batch.done <- err
+		}
+	}
+}
+
+// deliver posts a batch, or spools it when HEC is failing or older batches
+// are still waiting to be replayed.
+func (b *hecBatcher) deliver(batch hecBatch) error {
+	if b.spool == nil || b.spool.Empty() {
+		err := b.send(context.Background(), batch.body, batch.events, nil)
+		if err == nil {
+			return nil
+		}
+		return b.fallback(batch.body, batch.events, err)
+	}
+	return b.fallback(batch.body, batch.events, nil)
+}
+
+// fallback spools a batch that could not be delivered, or drops it when no
+// spool is configured.
+func (b *hecBatcher) fallback(body []byte, events int, cause error) error {
+	if b.spool == nil {
+		logger.Log.Errorf("Failed to send %d events to Splunk: %v", events, cause)
+		return cause
+	}
+	if cause != nil {
+		logger.Log.Warnf("Failed to send %d events to Splunk, spooling: %v", events, cause)
+	}
+
+	if err := b.spool.Append(body); err != nil {
+		logger.Log.Errorf("Failed to spool %d events, dropping: %v", events, err)
+		return err
+	}
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// send posts a batch. With indexer acknowledgement enabled the batch stays in
+// the in-flight buffer until Splunk confirms it was indexed, and the outcome
+// is reported on acked if it is non-nil.
+func (b *hecBatcher) send(ctx context.Context, body []byte, events int, acked chan<- error) error {
+	if b.acks == nil {
+		_, err := b.post(ctx, body)
+		return err
+	}
+
+	b.acks.acquire()
+	ackID, err := b.post(ctx, body)
+	if err != nil {
+		b.acks.release()
+		return err
+	}
+	b.acks.track(ackID, body, events, acked)
+	return nil
+}
+
+// replayLoop drains the spool in order, backing off exponentially while
+// HEC keeps failing. With indexer acknowledgement a record is only removed
+// from the spool once Splunk has confirmed it, so replay waits for each ack.
+func (b *hecBatcher) replayLoop() {
+	defer b.wg.Done()
+	backoff := time.Second
+	acked := make(chan error, 1)
+
+	for {
+		record, pos, err := b.spool.Peek()
+		if err == io.EOF {
+			select {
+			case <-b.wake:
+				continue
+			case <-b.stop:
+				return
+			}
+		}
+		if err != nil {
+			logger.Log.Errorf("Failed to read spool: %v", err)
+			select {
+			case <-time.After(backoff):
+				continue
+			case <-b.stop:
+				return
+			}
+		}
+
+		err = b.send(context.Background(), record, 0, acked)
+		if err == nil && b.acks != nil {
+			select {
+			case err = <-acked:
+			case <-b.stop:
+				return
+			}
+		}
+		if err != nil {
+			logger.Log.Warnf("Spool replay failed, retrying in %s: %v", backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-b.stop:
+				return
+			}
+			backoff = min(backoff*2, b.maxBackoff)
+			continue
+		}
+
+		backoff = time.Second
+		if err := b.spool.Ack(pos); err != nil {
+			logger.Log.Errorf("Failed to advance spool: %v", err)
+		}
+	}
+}
+
+type hecResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+// post sends one request to the event endpoint and returns the ack ID when
+// indexer acknowledgement is enabled.
+func (b *hecBatcher) post(ctx context.Context, body []byte) (int64, error) {
+	req := b.client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", "Splunk "+b.token).
+		SetHeader("Content-Type", "application/json")
+
+	if b.acks != nil {
+		req.SetHeader("X-Splunk-Request-Channel", b.acks.channel)
+	}
+
+	if b.cfg.Gzip {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		if _, err := zw.Write(body); err != nil {
+			return 0, fmt.Errorf("gzip: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return 0, fmt.Errorf("gzip: %w", err)
+		}
+		req.SetHeader("Content-Encoding", "gzip")
+		body = zbuf.Bytes()
+	}
+
+	resp, err := req.SetBody(body).Post(b.url + "/services/collector/event")
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.IsError() {
+		return 0, fmt.Errorf("error response: %s: %s", resp.Status(), resp.String())
+	}
+
+	if b.acks == nil {
+		return 0, nil
+	}
+	var result hecResponse
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return 0, fmt.Errorf("decode HEC response: %w", err)
+	}
+	if result.AckID == nil {
+		return 0, fmt.Errorf("no ackId in HEC response, is indexer acknowledgement enabled on the token?")
+	}
+	return *result.AckID, nil
+}
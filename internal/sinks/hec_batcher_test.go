@@ -0,0 +1,117 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/schema"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+	"github.com/go-resty/resty/v2"
+)
+
+func TestHECBatcherSplitsBatches(t *testing.T) {
+	for _, gzip := range []bool{false, true} {
+		t.Run(fmt.Sprintf("gzip=%t", gzip), func(t *testing.T) {
+			hec := newFakeHEC(t, nil)
+			b := newHECBatcher(hec.URL, "token", resty.New(), BatchConfig{MaxEvents: 2, FlushInterval: time.Hour, Gzip: gzip}, nil, 0, AckConfig{})
+			defer b.Close()
+
+			for i := range 5 {
+				if err := b.Add(fmt.Appendf(nil, `{"event":%d}`, i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := b.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{`{"event":0}{"event":1}`, `{"event":2}{"event":3}`, `{"event":4}`}
+			if n := hec.postCount(); n != len(want) {
+				t.Fatalf("got %d posts, want %d", n, len(want))
+			}
+			for i, w := range want {
+				if got := hec.post(i); got != w {
+					t.Errorf("post %d = %s, want %s", i, got, w)
+				}
+			}
+		})
+	}
+}
+
+func TestHECBatcherSplitsOnBytes(t *testing.T) {
+	hec := newFakeHEC(t, nil)
+	event := `{"event":"` + strings.Repeat("x", 40) + `"}`
+	b := newHECBatcher(hec.URL, "token", resty.New(), BatchConfig{MaxBytes: 2*len(event) + 1, FlushInterval: time.Hour}, nil, 0, AckConfig{})
+	defer b.Close()
+
+	for range 3 {
+		if err := b.Add([]byte(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := hec.postCount(); n != 2 {
+		t.Fatalf("got %d posts, want 2", n)
+	}
+}
+
+func BenchmarkHECBatcher(b *testing.B) {
+	hec := newFakeHEC(b, nil)
+	event := Event{
+		Kind: KindTraffic,
+		Time: time.Now(),
+		Traffic: &apicontracts.SplunkTrafficEvent{
+			Message:    "TYPE_START",
+			FlowID:     "3c5e1a2b-8f4d-4b6e-9a7c-1d2e3f4a5b6c",
+			ReporterID: "peer-1",
+			Protocol:   "TCP",
+			Direction:  "INGRESS",
+			SrcIP:      "100.64.0.10",
+			SrcPort:    51234,
+			DstIP:      "10.0.0.5",
+			DstPort:    443,
+			SourceName: "laptop-1",
+			Email:      "user@example.com",
+			PolicyName: "Allow HTTPS",
+		},
+	}
+	targets := map[Kind]hecTarget{KindTraffic: {Token: "token", Index: "netbird"}}
+
+	for _, bc := range []struct {
+		name      string
+		maxEvents int
+	}{
+		{"unbatched", 1},
+		{"batched", 100},
+	} {
+		for _, gzip := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/gzip=%t", bc.name, gzip), func(b *testing.B) {
+				batch := BatchConfig{MaxEvents: bc.maxEvents, FlushInterval: time.Hour, Gzip: gzip}
+				s, err := NewSplunkHECSink(hec.URL, "host", "netbird", targets, schema.Native{}, 5*time.Second, batch, nil, AckConfig{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				before := hec.postCount()
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for range b.N {
+					if err := s.Send(context.Background(), event); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := s.Flush(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				b.ReportMetric(float64(hec.postCount()-before)/float64(b.N), "posts/op")
+				s.Close()
+			})
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/logger"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/schema"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+type Kind string
+
+const (
+	KindTraffic Kind = "traffic"
+	KindAudit   Kind = "audit"
+	KindFlow    Kind = "flow"
+)
+
+// Event is a processed record handed to the sinks. Exactly one of Traffic,
+// Audit and Flow is set, matching Kind.
+type Event struct {
+	Kind    Kind
+	Time    time.Time
+	Traffic *apicontracts.SplunkTrafficEvent
+	Audit   *apicontracts.SplunkAuditEvent
+	Flow    *apicontracts.SplunkFlowEvent
+}
+
+func TrafficEvent(ts time.Time, ev apicontracts.SplunkTrafficEvent) Event {
+	return Event{Kind: KindTraffic, Time: ts, Traffic: &ev}
+}
+
+func AuditEvent(ts time.Time, ev apicontracts.SplunkAuditEvent) Event {
+	return Event{Kind: KindAudit, Time: ts, Audit: &ev}
+}
+
+func FlowEvent(ts time.Time, ev apicontracts.SplunkFlowEvent) Event {
+	return Event{Kind: KindFlow, Time: ts, Flow: &ev}
+}
+
+// Render returns the document of the event in the schema of m.
+func (e Event) Render(m schema.Mapper) (any, error) {
+	switch e.Kind {
+	case KindTraffic:
+		return m.Traffic(e.Time, e.Traffic), nil
+	case KindAudit:
+		return m.Audit(e.Time, e.Audit), nil
+	case KindFlow:
+		return m.Flow(e.Time, e.Flow), nil
+	}
+	return nil, fmt.Errorf("unsupported event kind %q", e.Kind)
+}
+
+// Sink is an output destination for processed NetBird events.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, event Event) error
+	Flush(ctx context.Context) error
+	Close() error
+}
+
+var GlobalSinks *MultiSink
+
+// MultiSink fans every event out to all configured sinks.
+type MultiSink struct {
+	sinks []Sink
+}
+
+func NewMultiSink(sinks ...Sink) *MultiSink {
+	return &MultiSink{sinks: sinks}
+}
+
+func (m *MultiSink) Name() string {
+	return "multi"
+}
+
+func (m *MultiSink) Len() int {
+	return len(m.sinks)
+}
+
+func (m *MultiSink) Send(ctx context.Context, event Event) error {
+	var errs []error
+	for _, s := range m.sinks {
+		if err := s.Send(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *MultiSink) Flush(ctx context.Context) error {
+	var errs []error
+	for _, s := range m.sinks {
+		if err := s.Flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *MultiSink) Close() error {
+	var errs []error
+	for _, s := range m.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// InitSinks builds the configured sinks and installs them as GlobalSinks.
+func InitSinks() error {
+	var sinks []Sink
+
+	splunk, err := NewSplunkHECSinkFromConfig()
+	if err != nil {
+		return fmt.Errorf("splunk sink: %w", err)
+	}
+	if splunk != nil {
+		sinks = append(sinks, splunk)
+	}
+
+	files, err := NewFileSinksFromConfig()
+	if err != nil {
+		return fmt.Errorf("file sink: %w", err)
+	}
+	sinks = append(sinks, files...)
+
+	if len(sinks) == 0 {
+		logger.Log.Warnln("No sinks configured, events will be discarded")
+	}
+
+	GlobalSinks = NewMultiSink(sinks...)
+	return nil
+}
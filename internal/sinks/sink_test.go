@@ -0,0 +1,145 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/schema"
+	"github.com/NorskHelsenett/netbird-log-forwarder/pkg/models/apicontracts"
+)
+
+// recordingSink keeps the kinds it was sent and fails with err when set.
+type recordingSink struct {
+	name   string
+	err    error
+	sent   []Kind
+	closed bool
+}
+
+func (r *recordingSink) Name() string { return r.name }
+
+func (r *recordingSink) Send(_ context.Context, event Event) error {
+	r.sent = append(r.sent, event.Kind)
+	return r.err
+}
+
+func (r *recordingSink) Flush(context.Context) error { return r.err }
+
+func (r *recordingSink) Close() error {
+	r.closed = true
+	return r.err
+}
+
+func TestMultiSinkFansOut(t *testing.T) {
+	boom := errors.New("boom")
+	ok := &recordingSink{name: "ok"}
+	bad := &recordingSink{name: "bad", err: boom}
+	m := NewMultiSink(bad, ok)
+	if m.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", m.Len())
+	}
+
+	event := TrafficEvent(time.Now(), apicontracts.SplunkTrafficEvent{})
+	err := m.Send(context.Background(), event)
+	if !errors.Is(err, boom) || !strings.Contains(err.Error(), "sink bad: boom") {
+		t.Errorf("Send error = %v, want it to name the failing sink", err)
+	}
+	// A failing sink does not keep the event from the others.
+	if len(ok.sent) != 1 || ok.sent[0] != KindTraffic {
+		t.Errorf("ok sink got %v", ok.sent)
+	}
+
+	if err := m.Flush(context.Background()); !errors.Is(err, boom) {
+		t.Errorf("Flush error = %v", err)
+	}
+	if err := m.Close(); !errors.Is(err, boom) || !ok.closed || !bad.closed {
+		t.Errorf("Close error = %v, closed ok=%t bad=%t", err, ok.closed, bad.closed)
+	}
+
+	if err := NewMultiSink(ok).Send(context.Background(), event); err != nil {
+		t.Errorf("Send without failures = %v", err)
+	}
+}
+
+func TestEventRender(t *testing.T) {
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		event   Event
+		want    any
+		wantErr bool
+	}{
+		{"traffic", TrafficEvent(ts, apicontracts.SplunkTrafficEvent{Message: "TYPE_START"}), &apicontracts.SplunkTrafficEvent{Message: "TYPE_START"}, false},
+		{"audit", AuditEvent(ts, apicontracts.SplunkAuditEvent{Message: "User joined"}), &apicontracts.SplunkAuditEvent{Message: "User joined"}, false},
+		{"flow", FlowEvent(ts, apicontracts.SplunkFlowEvent{FlowID: "flow-1"}), &apicontracts.SplunkFlowEvent{FlowID: "flow-1"}, false},
+		{"unknown kind", Event{Kind: "metric", Time: ts}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.event.Render(schema.Native{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render error = %v, wantErr %t", err, tt.wantErr)
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("Render = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestSplunkHECSinkEnvelope(t *testing.T) {
+	hec := newFakeHEC(t, nil)
+	targets := map[Kind]hecTarget{
+		KindTraffic: {Token: "t", Index: "netbird_traffic", SourceType: "netbird:traffic"},
+		KindAudit:   {Token: "t", Index: "netbird_audit", SourceType: "netbird:audit"},
+		// No index, so flows are not forwarded.
+		KindFlow: {Token: "t"},
+	}
+	s, err := NewSplunkHECSink(hec.URL, "forwarder-1", "netbird", targets, schema.Native{}, time.Second, BatchConfig{FlushInterval: time.Hour}, nil, AckConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 500_000_000, time.UTC)
+	for _, ev := range []Event{
+		TrafficEvent(ts, apicontracts.SplunkTrafficEvent{Message: "TYPE_START"}),
+		AuditEvent(ts, apicontracts.SplunkAuditEvent{Message: "User joined"}),
+		FlowEvent(ts, apicontracts.SplunkFlowEvent{FlowID: "flow-1"}),
+	} {
+		if err := s.Send(context.Background(), ev); err != nil {
+			t.Fatalf("Send %s: %v", ev.Kind, err)
+		}
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := hec.postCount(); n != 2 {
+		t.Fatalf("got %d posts, want one per enabled kind", n)
+	}
+	got := make(map[string]hecEvent)
+	for i := range 2 {
+		var env hecEvent
+		if err := json.Unmarshal([]byte(hec.post(i)), &env); err != nil {
+			t.Fatal(err)
+		}
+		got[env.Index] = env
+	}
+	for index, sourceType := range map[string]string{"netbird_traffic": "netbird:traffic", "netbird_audit": "netbird:audit"} {
+		env, ok := got[index]
+		if !ok {
+			t.Errorf("nothing posted to %s", index)
+			continue
+		}
+		if env.SourceType != sourceType || env.Host != "forwarder-1" || env.Source != "netbird" || env.Time != 1767268800.5 {
+			t.Errorf("%s envelope = %+v", index, env)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/schema"
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/spool"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/viper"
+)
+
+type hecTarget struct {
+	Token      string
+	Index      string
+	SourceType string
+}
+
+func (t hecTarget) enabled() bool {
+	return t.Token != "" && t.Index != ""
+}
+
+// SpoolConfig enables on-disk buffering of batches HEC did not accept. Each
+// event kind gets its own subdirectory of Dir.
+type SpoolConfig struct {
+	spool.Config
+	MaxBackoff time.Duration
+}
+
+type SplunkHECSink struct {
+	url     string
+	host    string
+	source  string
+	targets map[Kind]hecTarget
+	profile schema.Mapper
+	client  *resty.Client
+
+	batchers map[Kind]*hecBatcher
+}
+
+// hecEvent is the envelope expected by /services/collector/event.
+type hecEvent struct {
+	Time       float64 `json:"time"`
+	Host       string  `json:"host,omitempty"`
+	Source     string  `json:"source,omitempty"`
+	SourceType string  `json:"sourcetype,omitempty"`
+	Index      string  `json:"index,omitempty"`
+	Event      any     `json:"event"`
+}
+
+func NewSplunkHECSink(url, host, source string, targets map[Kind]hecTarget, profile schema.Mapper, timeout time.Duration, batch BatchConfig, spoolCfg *SpoolConfig, ack AckConfig) (*SplunkHECSink, error) {
+	s := &SplunkHECSink{
+		url:      url,
+		host:     host,
+		source:   source,
+		targets:  targets,
+		profile:  profile,
+		client:   resty.New().SetTimeout(timeout),
+		batchers: make(map[Kind]*hecBatcher),
+	}
+	for kind, t := range targets {
+		if !t.enabled() {
+			continue
+		}
+		var sp *spool.Spool
+		var maxBackoff time.Duration
+		if spoolCfg != nil {
+			cfg := spoolCfg.Config
+			cfg.Dir = filepath.Join(spoolCfg.Dir, string(kind))
+			var err error
+			if sp, err = spool.Open(cfg); err != nil {
+				_ = s.Close()
+				return nil, fmt.Errorf("open %s spool: %w", kind, err)
+			}
+			maxBackoff = spoolCfg.MaxBackoff
+		}
+		s.batchers[kind] = newHECBatcher(url, t.Token, s.client, batch, sp, maxBackoff, ack)
+	}
+	return s, nil
+}
+
+// NewSplunkHECSinkFromConfig reads the splunk.* keys. It returns nil when
+// neither traffic nor audit forwarding is configured.
+func NewSplunkHECSinkFromConfig() (*SplunkHECSink, error) {
+	url := viper.GetString("splunk.url")
+	if url == "" {
+		return nil, nil
+	}
+
+	host := viper.GetString("splunk_host")
+	if host == "" {
+		hostname, _ := os.Hostname()
+		if hostname == "" {
+			hostname = "unknown-host"
+		}
+		host = hostname
+	}
+
+	source := viper.GetString("splunk.traffic_source")
+	if source == "" {
+		source = "netbird"
+	}
+
+	traffic := hecTarget{
+		Token:      viper.GetString("splunk.traffic_token"),
+		Index:      viper.GetString("splunk.traffic_index"),
+		SourceType: viper.GetString("splunk.traffic_source_type"),
+	}
+	if traffic.SourceType == "" {
+		traffic.SourceType = "netbird:traffic"
+	}
+
+	audit := hecTarget{
+		Token:      viper.GetString("splunk.audit_token"),
+		Index:      viper.GetString("splunk.audit_index"),
+		SourceType: viper.GetString("splunk.audit_source_type"),
+	}
+	if audit.Token == "" {
+		audit.Token = traffic.Token
+	}
+	if audit.SourceType == "" {
+		audit.SourceType = viper.GetString("splunk_audit_source")
+	}
+	if audit.SourceType == "" {
+		audit.SourceType = "netbird:audit"
+	}
+
+	// Aggregated flows go next to the raw traffic unless configured otherwise.
+	flow := hecTarget{
+		Token:      viper.GetString("splunk.flow_token"),
+		Index:      viper.GetString("splunk.flow_index"),
+		SourceType: viper.GetString("splunk.flow_source_type"),
+	}
+	if flow.Token == "" {
+		flow.Token = traffic.Token
+	}
+	if flow.Index == "" {
+		flow.Index = traffic.Index
+	}
+	if flow.SourceType == "" {
+		flow.SourceType = "netbird:flow"
+	}
+
+	if !traffic.enabled() && !audit.enabled() {
+		return nil, nil
+	}
+
+	batch := BatchConfig{
+		MaxEvents:     viper.GetInt("splunk.batch.max_events"),
+		MaxBytes:      viper.GetInt("splunk.batch.max_bytes"),
+		FlushInterval: viper.GetDuration("splunk.batch.flush_interval"),
+		Gzip:          viper.GetBool("splunk.batch.gzip"),
+	}
+
+	var spoolCfg *SpoolConfig
+	if dir := viper.GetString("splunk.spool.dir"); dir != "" {
+		spoolCfg = &SpoolConfig{
+			Config: spool.Config{
+				Dir:          dir,
+				MaxBytes:     viper.GetInt64("splunk.spool.max_bytes"),
+				SegmentBytes: viper.GetInt64("splunk.spool.segment_bytes"),
+				DropPolicy:   spool.DropPolicy(viper.GetString("splunk.spool.drop_policy")),
+			},
+			MaxBackoff: viper.GetDuration("splunk.spool.max_backoff"),
+		}
+	}
+
+	ack := AckConfig{
+		Enabled:      viper.GetBool("splunk.ack.enabled"),
+		PollInterval: viper.GetDuration("splunk.ack.poll_interval"),
+		Timeout:      viper.GetDuration("splunk.ack.timeout"),
+		MaxInFlight:  viper.GetInt("splunk.ack.max_in_flight"),
+	}
+
+	profile, err := schema.Lookup(viper.GetString("splunk.profile"))
+	if err != nil {
+		return nil, err
+	}
+
+	targets := map[Kind]hecTarget{KindTraffic: traffic, KindAudit: audit, KindFlow: flow}
+	return NewSplunkHECSink(url, host, source, targets, profile, 5*time.Second, batch, spoolCfg, ack)
+}
+
+func (s *SplunkHECSink) Name() string {
+	return "splunk"
+}
+
+func (s *SplunkHECSink) Send(ctx context.Context, event Event) error {
+	target := s.targets[event.Kind]
+	if !target.enabled() {
+		return nil
+	}
+
+	body, err := event.Render(s.profile)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(hecEvent{
+		Time:       float64(event.Time.UnixMilli()) / 1e3,
+		Host:       s.host,
+		Source:     s.source,
+		SourceType: target.SourceType,
+		Index:      target.Index,
+		Event:      body,
+	})
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+
+	return s.batchers[event.Kind].Add(payload)
+}
+
+func (s *SplunkHECSink) Flush(ctx context.Context) error {
+	var errs []error
+	for _, b := range s.batchers {
+		errs = append(errs, b.Flush(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *SplunkHECSink) Close() error {
+	var errs []error
+	for _, b := range s.batchers {
+		errs = append(errs, b.Close())
+	}
+	return errors.Join(errs...)
+}
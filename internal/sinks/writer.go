@@ -0,0 +1,52 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/NorskHelsenett/netbird-log-forwarder/internal/schema"
+)
+
+// WriterSink writes one JSON document per event to an io.Writer. It is used
+// for dry runs and debugging.
+type WriterSink struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	profile schema.Mapper
+}
+
+type writerRecord struct {
+	Kind  Kind   `json:"kind"`
+	Time  string `json:"time"`
+	Event any    `json:"event"`
+}
+
+func NewWriterSink(w io.Writer, profile schema.Mapper) *WriterSink {
+	return &WriterSink{enc: json.NewEncoder(w), profile: profile}
+}
+
+func (s *WriterSink) Name() string {
+	return "writer"
+}
+
+func (s *WriterSink) Send(ctx context.Context, event Event) error {
+	body, err := event.Render(s.profile)
+	if err != nil {
+		return err
+	}
+	record := writerRecord{Kind: event.Kind, Time: event.Time.UTC().Format("2006-01-02T15:04:05.000Z07:00"), Event: body}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(record)
+}
+
+func (s *WriterSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *WriterSink) Close() error {
+	return nil
+}
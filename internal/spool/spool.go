@@ -0,0 +1,403 @@
+package spool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// On-disk layout: <dir>/<seq>.seg files, each a sequence of records
+//
+//	[4 byte length][4 byte CRC32 of payload][payload]
+//
+// plus a cursor file remembering how far into the oldest segment we have
+// replayed, so a restart does not resend what was already delivered.
+
+const (
+	segmentExt  = ".seg"
+	cursorFile  = "cursor.json"
+	headerBytes = 8
+)
+
+type DropPolicy string
+
+const (
+	DropOldest DropPolicy = "drop_oldest"
+	DropNewest DropPolicy = "drop_newest"
+)
+
+var ErrFull = errors.New("spool full")
+
+type Config struct {
+	Dir          string
+	MaxBytes     int64
+	SegmentBytes int64
+	DropPolicy   DropPolicy
+}
+
+type segment struct {
+	seq  uint64
+	size int64
+}
+
+type cursor struct {
+	Seq    uint64 `json:"seq"`
+	Offset int64  `json:"offset"`
+}
+
+// Position identifies a record returned by Peek, so Ack can tell whether
+// that record is still the head of the spool.
+type Position struct {
+	Seq    uint64
+	Offset int64
+	Length int64
+}
+
+// Spool is a FIFO of records persisted as append-only segment files.
+type Spool struct {
+	cfg Config
+
+	mu       sync.Mutex
+	segments []segment // oldest first, last one is the write segment
+	writer   *os.File
+	read     cursor
+	lastSeq  uint64 // segment numbers are never reused, see Ack
+	dropped  uint64
+}
+
+func Open(cfg Config) (*Spool, error) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 1 << 30
+	}
+	if cfg.SegmentBytes <= 0 {
+		cfg.SegmentBytes = 16 << 20
+	}
+	if cfg.SegmentBytes > cfg.MaxBytes {
+		cfg.SegmentBytes = cfg.MaxBytes
+	}
+	switch cfg.DropPolicy {
+	case "":
+		cfg.DropPolicy = DropOldest
+	case DropOldest, DropNewest:
+	default:
+		return nil, fmt.Errorf("unknown drop policy %q", cfg.DropPolicy)
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+
+	s := &Spool{cfg: cfg}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("read spool dir: %w", err)
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return fmt.Errorf("stat segment %s: %w", name, err)
+		}
+		s.segments = append(s.segments, segment{seq: seq, size: info.Size()})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+	if len(s.segments) > 0 {
+		s.lastSeq = s.segments[len(s.segments)-1].seq
+	}
+
+	if b, err := os.ReadFile(filepath.Join(s.cfg.Dir, cursorFile)); err == nil {
+		_ = json.Unmarshal(b, &s.read)
+	}
+	if len(s.segments) == 0 || s.read.Seq != s.segments[0].seq {
+		s.read = cursor{}
+		if len(s.segments) > 0 {
+			s.read.Seq = s.segments[0].seq
+		}
+	}
+	return nil
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+// Size returns the number of bytes currently held on disk.
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sizeLocked()
+}
+
+func (s *Spool) sizeLocked() int64 {
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	return total - s.read.Offset
+}
+
+// Empty reports whether there is nothing left to replay.
+func (s *Spool) Empty() bool {
+	return s.Size() == 0
+}
+
+// Dropped returns how many records the drop policy has discarded.
+func (s *Spool) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Append writes one record to the tail of the spool.
+func (s *Spool) Append(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	need := int64(len(record) + headerBytes)
+	if need > s.cfg.MaxBytes {
+		s.dropped++
+		return ErrFull
+	}
+	for s.sizeLocked()+need > s.cfg.MaxBytes {
+		if s.cfg.DropPolicy == DropNewest || len(s.segments) == 0 {
+			s.dropped++
+			return ErrFull
+		}
+		if err := s.dropOldestLocked(); err != nil {
+			return err
+		}
+	}
+
+	if s.writer == nil || s.segments[len(s.segments)-1].size+need > s.cfg.SegmentBytes {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	buf := make([]byte, headerBytes+len(record))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(record)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(record))
+	copy(buf[headerBytes:], record)
+
+	if _, err := s.writer.Write(buf); err != nil {
+		return fmt.Errorf("write spool record: %w", err)
+	}
+	if err := s.writer.Sync(); err != nil {
+		return fmt.Errorf("sync spool segment: %w", err)
+	}
+	s.segments[len(s.segments)-1].size += need
+	return nil
+}
+
+func (s *Spool) rotateLocked() error {
+	if s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			return fmt.Errorf("close spool segment: %w", err)
+		}
+		s.writer = nil
+	}
+
+	s.lastSeq++
+	seq := s.lastSeq
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("create spool segment: %w", err)
+	}
+	s.writer = f
+	s.segments = append(s.segments, segment{seq: seq})
+	if len(s.segments) == 1 {
+		s.read = cursor{Seq: seq}
+	}
+	return nil
+}
+
+func (s *Spool) dropOldestLocked() error {
+	oldest := s.segments[0]
+	if len(s.segments) == 1 && s.writer != nil {
+		_ = s.writer.Close()
+		s.writer = nil
+	}
+	s.dropped += uint64(s.countRecordsLocked(oldest))
+	if err := os.Remove(s.segmentPath(oldest.seq)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove spool segment: %w", err)
+	}
+	s.segments = s.segments[1:]
+	s.read = cursor{}
+	if len(s.segments) > 0 {
+		s.read.Seq = s.segments[0].seq
+	}
+	return s.saveCursorLocked()
+}
+
+// countRecordsLocked returns the number of unread records in seg, used for
+// drop accounting only.
+func (s *Spool) countRecordsLocked(seg segment) int {
+	f, err := os.Open(s.segmentPath(seg.seq))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	var offset int64
+	if seg.seq == s.read.Seq {
+		offset = s.read.Offset
+	}
+	n := 0
+	header := make([]byte, headerBytes)
+	for offset < seg.size {
+		if _, err := f.ReadAt(header, offset); err != nil {
+			break
+		}
+		offset += headerBytes + int64(binary.BigEndian.Uint32(header[0:4]))
+		n++
+	}
+	return n
+}
+
+// Peek returns the oldest unacknowledged record and its position. It returns
+// io.EOF when the spool is empty. Corrupt or truncated records are skipped.
+func (s *Spool) Peek() ([]byte, Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.segments) > 0 {
+		seg := s.segments[0]
+		if s.read.Offset >= seg.size {
+			if len(s.segments) == 1 {
+				return nil, Position{}, io.EOF
+			}
+			if err := s.removeHeadLocked(); err != nil {
+				return nil, Position{}, err
+			}
+			continue
+		}
+
+		record, err := s.readRecordLocked(seg)
+		if err == nil {
+			return record, Position{Seq: seg.seq, Offset: s.read.Offset, Length: int64(len(record))}, nil
+		}
+		// Skip the rest of a damaged segment rather than blocking replay.
+		s.read.Offset = seg.size
+		if len(s.segments) == 1 {
+			if err := s.saveCursorLocked(); err != nil {
+				return nil, Position{}, err
+			}
+			return nil, Position{}, io.EOF
+		}
+	}
+	return nil, Position{}, io.EOF
+}
+
+func (s *Spool) readRecordLocked(seg segment) ([]byte, error) {
+	f, err := os.Open(s.segmentPath(seg.seq))
+	if err != nil {
+		return nil, fmt.Errorf("open spool segment: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, headerBytes)
+	if _, err := f.ReadAt(header, s.read.Offset); err != nil {
+		return nil, fmt.Errorf("read record header: %w", err)
+	}
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	if s.read.Offset+headerBytes+length > seg.size {
+		return nil, fmt.Errorf("truncated record at offset %d", s.read.Offset)
+	}
+	record := make([]byte, length)
+	if _, err := f.ReadAt(record, s.read.Offset+headerBytes); err != nil {
+		return nil, fmt.Errorf("read record: %w", err)
+	}
+	if crc32.ChecksumIEEE(record) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("checksum mismatch at offset %d", s.read.Offset)
+	}
+	return record, nil
+}
+
+// Ack removes the record Peek returned at pos. It does nothing when that
+// record is no longer the head, e.g. because the drop policy discarded its
+// segment in the meantime.
+func (s *Spool) Ack(pos Position) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.segments) == 0 || s.read.Seq != pos.Seq || s.read.Offset != pos.Offset {
+		return nil
+	}
+	seg := s.segments[0]
+	s.read.Offset += headerBytes + pos.Length
+
+	if s.read.Offset >= seg.size {
+		return s.removeHeadLocked()
+	}
+	return s.saveCursorLocked()
+}
+
+// removeHeadLocked deletes the fully replayed oldest segment.
+func (s *Spool) removeHeadLocked() error {
+	seg := s.segments[0]
+	if len(s.segments) == 1 && s.writer != nil {
+		if err := s.writer.Close(); err != nil {
+			return fmt.Errorf("close spool segment: %w", err)
+		}
+		s.writer = nil
+	}
+	if err := os.Remove(s.segmentPath(seg.seq)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove spool segment: %w", err)
+	}
+	s.segments = s.segments[1:]
+	s.read = cursor{}
+	if len(s.segments) > 0 {
+		s.read.Seq = s.segments[0].seq
+	}
+	return s.saveCursorLocked()
+}
+
+func (s *Spool) saveCursorLocked() error {
+	b, err := json.Marshal(s.read)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.cfg.Dir, cursorFile+".tmp")
+	if err := os.WriteFile(tmp, b, 0o640); err != nil {
+		return fmt.Errorf("write spool cursor: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.cfg.Dir, cursorFile)); err != nil {
+		return fmt.Errorf("write spool cursor: %w", err)
+	}
+	return nil
+}
+
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writer == nil {
+		return nil
+	}
+	err := s.writer.Close()
+	s.writer = nil
+	return err
+}
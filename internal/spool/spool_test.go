@@ -0,0 +1,205 @@
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// record returns an 8 byte payload, so every record is 16 bytes on disk.
+func record(i uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, i)
+	return b
+}
+
+func open(t *testing.T, cfg Config) *Spool {
+	t.Helper()
+	if cfg.Dir == "" {
+		cfg.Dir = t.TempDir()
+	}
+	s, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func mustAppend(t *testing.T, s *Spool, ids ...uint64) {
+	t.Helper()
+	for _, id := range ids {
+		if err := s.Append(record(id)); err != nil {
+			t.Fatalf("append %d: %v", id, err)
+		}
+	}
+}
+
+func mustPeek(t *testing.T, s *Spool) (uint64, Position) {
+	t.Helper()
+	b, pos, err := s.Peek()
+	if err != nil {
+		t.Fatalf("peek: %v", err)
+	}
+	return binary.BigEndian.Uint64(b), pos
+}
+
+func TestFIFOAcrossSegments(t *testing.T) {
+	s := open(t, Config{SegmentBytes: 32})
+	mustAppend(t, s, 0, 1, 2, 3, 4)
+
+	for want := uint64(0); want < 5; want++ {
+		got, pos := mustPeek(t, s)
+		if got != want {
+			t.Fatalf("peek = %d, want %d", got, want)
+		}
+		if err := s.Ack(pos); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := s.Peek(); !errors.Is(err, io.EOF) {
+		t.Fatalf("peek on empty spool: %v, want io.EOF", err)
+	}
+	if !s.Empty() {
+		t.Errorf("spool not empty, size %d", s.Size())
+	}
+}
+
+func TestCursorSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s := open(t, Config{Dir: dir, SegmentBytes: 32})
+	mustAppend(t, s, 0, 1, 2)
+	_, pos := mustPeek(t, s)
+	if err := s.Ack(pos); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = open(t, Config{Dir: dir, SegmentBytes: 32})
+	if got, _ := mustPeek(t, s); got != 1 {
+		t.Fatalf("peek after restart = %d, want 1", got)
+	}
+}
+
+func TestDropPolicies(t *testing.T) {
+	t.Run("drop_newest", func(t *testing.T) {
+		s := open(t, Config{MaxBytes: 32, SegmentBytes: 32, DropPolicy: DropNewest})
+		mustAppend(t, s, 0, 1)
+		if err := s.Append(record(2)); !errors.Is(err, ErrFull) {
+			t.Fatalf("append to full spool: %v, want ErrFull", err)
+		}
+		if got, _ := mustPeek(t, s); got != 0 {
+			t.Errorf("peek = %d, want 0", got)
+		}
+		if s.Dropped() != 1 {
+			t.Errorf("dropped = %d, want 1", s.Dropped())
+		}
+	})
+	t.Run("drop_oldest", func(t *testing.T) {
+		s := open(t, Config{MaxBytes: 64, SegmentBytes: 32, DropPolicy: DropOldest})
+		mustAppend(t, s, 0, 1, 2, 3, 4)
+		if got, _ := mustPeek(t, s); got != 2 {
+			t.Errorf("peek = %d, want 2", got)
+		}
+		if s.Dropped() != 2 {
+			t.Errorf("dropped = %d, want 2", s.Dropped())
+		}
+	})
+}
+
+// An Ack for a record that drop_oldest discarded after Peek must not remove
+// the record that took its place.
+func TestAckAfterDropIsNoop(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		before   []uint64
+		overflow uint64
+		want     uint64
+	}{
+		{"head segment dropped", Config{MaxBytes: 64, SegmentBytes: 32}, []uint64{0, 1, 2, 3}, 4, 2},
+		// The only segment is dropped, so the next one would have the same
+		// sequence number if it were reused.
+		{"all segments dropped", Config{MaxBytes: 16, SegmentBytes: 16}, []uint64{0}, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := open(t, tt.cfg)
+			mustAppend(t, s, tt.before...)
+			_, pos := mustPeek(t, s)
+			mustAppend(t, s, tt.overflow)
+
+			if err := s.Ack(pos); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := mustPeek(t, s); got != tt.want {
+				t.Fatalf("peek after stale ack = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverflowDuringReplay(t *testing.T) {
+	const total = 2000
+	s := open(t, Config{MaxBytes: 256, SegmentBytes: 64, DropPolicy: DropOldest})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := uint64(0); i < total; i++ {
+			if err := s.Append(record(i)); err != nil {
+				t.Errorf("append %d: %v", i, err)
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var received []uint64
+replay:
+	for {
+		b, pos, err := s.Peek()
+		if errors.Is(err, io.EOF) {
+			select {
+			case <-done:
+				// The producer may have appended between Peek and done.
+				if s.Empty() {
+					break replay
+				}
+			default:
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		received = append(received, binary.BigEndian.Uint64(b))
+		if err := s.Ack(pos); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := make(map[uint64]bool, len(received))
+	for i, id := range received {
+		if i > 0 && id <= received[i-1] {
+			t.Fatalf("record %d replayed after %d", id, received[i-1])
+		}
+		seen[id] = true
+	}
+	if !seen[total-1] {
+		t.Error("last record never replayed")
+	}
+	// Every record that was not replayed must have been dropped by the
+	// policy. A record dropped after Peek is both replayed and dropped.
+	if lost := uint64(total - len(seen)); lost > s.Dropped() {
+		t.Errorf("%d records lost but only %d dropped", lost, s.Dropped())
+	}
+}
@@ -2,6 +2,7 @@ package apicontracts
 
 import (
 	"encoding/json"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -69,29 +70,198 @@ type TrafficEvent struct {
 // }
 
 type SplunkTrafficEvent struct {
-	Time       float64 `json:"time"`
-	Protocol   string  `json:"protocol"`
-	SrcIP      string  `json:"srcip"`
-	SrcPort    int     `json:"srcport"`
-	SourceName string  `json:"sourcename"`
-	Email      string  `json:"email"`
-	DstIP      string  `json:"dstip"`
-	DstPort    int     `json:"dstport"`
-	ExitNode   string  `json:"exitnode"`
-	Message    string  `json:"message"`
+	Protocol   string `json:"protocol"`
+	SrcIP      string `json:"src_ip"`
+	SrcPort    int    `json:"src_port"`
+	SourceName string `json:"source_name"`
+	Email      string `json:"email"`
+	DstIP      string `json:"dst_ip"`
+	DstPort    int    `json:"dst_port"`
+	ExitNode   string `json:"exit_node"`
+	Message    string `json:"message"`
+	CacheStale bool   `json:"cache_stale,omitempty"`
+
+	SrcTranslatedIP string `json:"src_translated_ip,omitempty"`
+	ReportedBy      string `json:"reported_by,omitempty"`
+
+	SrcGroups  []string `json:"src_groups,omitempty"`
+	SrcOS      string   `json:"src_os,omitempty"`
+	SrcVersion string   `json:"src_version,omitempty"`
+	SrcCountry string   `json:"src_country,omitempty"`
+	SrcCity    string   `json:"src_city,omitempty"`
+	DstGroups  []string `json:"dst_groups,omitempty"`
+	DstOS      string   `json:"dst_os,omitempty"`
+	DstVersion string   `json:"dst_version,omitempty"`
+	DstCountry string   `json:"dst_country,omitempty"`
+	DstCity    string   `json:"dst_city,omitempty"`
+
+	DstHostname string `json:"dst_hostname,omitempty"`
+	DstEmail    string `json:"dst_email,omitempty"`
+	DstUser     string `json:"dst_user,omitempty"`
+	DstResource string `json:"dst_resource,omitempty"`
+	DstNetwork  string `json:"dst_network,omitempty"`
+
+	PolicyID        string   `json:"policy_id,omitempty"`
+	PolicyName      string   `json:"policy_name,omitempty"`
+	PolicySrcGroups []string `json:"policy_src_groups,omitempty"`
+	PolicyDstGroups []string `json:"policy_dst_groups,omitempty"`
+
+	// Metadata passed through from TrafficMeta.
+	FlowID      string `json:"flow_id,omitempty"`
+	Direction   string `json:"direction,omitempty"`
+	ReporterID  string `json:"reporter_id,omitempty"`
+	SrcID       string `json:"src_id,omitempty"`
+	SrcType     string `json:"src_type,omitempty"`
+	SrcDNSLabel string `json:"src_dns_label,omitempty"`
+	DstID       string `json:"dst_id,omitempty"`
+	DstType     string `json:"dst_type,omitempty"`
+	DstName     string `json:"dst_name,omitempty"`
+	DstDNSLabel string `json:"dst_dns_label,omitempty"`
+	RxBytes     int    `json:"rx_bytes"`
+	TxBytes     int    `json:"tx_bytes"`
+	RxPackets   int    `json:"rx_packets"`
+	TxPackets   int    `json:"tx_packets"`
+	ICMPType    *int   `json:"icmp_type,omitempty"` // kun for ICMP, 0 er en gyldig type
+	ICMPCode    *int   `json:"icmp_code,omitempty"`
+	ReceivedAt  string `json:"received_timestamp,omitempty"`
+
+	Fields map[string]any `json:"-"` // beregnede felter, flates ut på toppnivå
+	// FieldSet limits the fixed fields that are forwarded. Nil keeps all.
+	FieldSet *FieldSet `json:"-"`
 }
 
-// type SplunkAuditEvent struct {
-// 	Time                 float64 `json:"time"`
-// 	User                 string  `json:"user"`
-// 	Message              string  `json:"message"`
-// 	LocationCityName     string  `json:"location_city_name"`
-// 	LocationCountryCode  string  `json:"location_country_code"`
-// 	LocationConnectionIp string  `json:"location_connection_ip"`
-// 	LocationGeoNameId    int     `json:"location_geo_name_id"`
-// 	Ip                   string  `json:"ip"`
-// 	Fqdn                 string  `json:"fqdn"`
-// }
+// FieldSet selects the top-level keys of a forwarded event by JSON name.
+// An empty Include keeps every key not in Exclude.
+type FieldSet struct {
+	Include map[string]bool
+	Exclude map[string]bool
+}
+
+func (f *FieldSet) Keep(key string) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Include) > 0 && !f.Include[key] {
+		return false
+	}
+	return !f.Exclude[key]
+}
+
+// MarshalJSON flattens Fields into the top-level object and applies
+// FieldSet to the fixed fields. The fixed fields win on key collisions.
+func (e SplunkTrafficEvent) MarshalJSON() ([]byte, error) {
+	type plain SplunkTrafficEvent
+	if len(e.Fields) == 0 && e.FieldSet == nil {
+		return json.Marshal(plain(e))
+	}
+
+	b, err := json.Marshal(plain(e))
+	if err != nil {
+		return nil, err
+	}
+	var fixed map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fixed); err != nil {
+		return nil, err
+	}
+	out := make(map[string]any, len(e.Fields)+len(fixed))
+	for k, v := range e.Fields {
+		out[k] = v
+	}
+	for k, v := range fixed {
+		if e.FieldSet.Keep(k) {
+			out[k] = v
+		}
+	}
+	return json.Marshal(out)
+}
+
+// SplunkFlowEvent is one connection consolidated from its start, end and
+// drop traffic events. Traffic holds the enrichment of the first event seen
+// and is flattened into the top-level object.
+type SplunkFlowEvent struct {
+	FlowID     string    `json:"flow_id"`
+	Start      time.Time `json:"flow_start"`
+	End        time.Time `json:"flow_end"`
+	Duration   float64   `json:"duration"` // sekunder
+	State      string    `json:"flow_state"`
+	RxBytes    int       `json:"rx_bytes"`
+	TxBytes    int       `json:"tx_bytes"`
+	RxPackets  int       `json:"rx_packets"`
+	TxPackets  int       `json:"tx_packets"`
+	EventCount int       `json:"event_count"`
+
+	Traffic SplunkTrafficEvent `json:"-"`
+}
+
+// MarshalJSON flattens Traffic into the top-level object. The flow fields
+// win on key collisions.
+func (e SplunkFlowEvent) MarshalJSON() ([]byte, error) {
+	type plain SplunkFlowEvent
+	b, err := json.Marshal(plain(e))
+	if err != nil {
+		return nil, err
+	}
+	traffic, err := json.Marshal(e.Traffic)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixed, out map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fixed); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(traffic, &out); err != nil {
+		return nil, err
+	}
+	for k, v := range fixed {
+		out[k] = v
+	}
+	return json.Marshal(out)
+}
+
+type SplunkAuditEvent struct {
+	Message     string `json:"message"`
+	InitiatorID string `json:"initiator_id"`
+	TargetID    string `json:"target_id"`
+	RawEvent    string `json:"raw_event"`
+	TargetType  string `json:"target_type,omitempty"`
+	TargetName  string `json:"target_name,omitempty"`
+	CacheStale  bool   `json:"cache_stale,omitempty"`
+
+	ActivityCode     string `json:"activity_code,omitempty"`
+	ActivityCategory string `json:"activity_category,omitempty"`
+	ActivityAction   string `json:"activity_action,omitempty"`
+	ActivitySeverity string `json:"activity_severity,omitempty"`
+	ActivityUnknown  bool   `json:"activity_unknown,omitempty"`
+
+	Extra map[string]any `json:"-"` // flates ut på toppnivå
+}
+
+// MarshalJSON flattens Extra into the top-level object. The fixed fields win
+// on key collisions.
+func (e SplunkAuditEvent) MarshalJSON() ([]byte, error) {
+	type plain SplunkAuditEvent
+	b, err := json.Marshal(plain(e))
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Extra) == 0 {
+		return b, nil
+	}
+
+	var fixed map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fixed); err != nil {
+		return nil, err
+	}
+	out := make(map[string]any, len(e.Extra)+len(fixed))
+	for k, v := range e.Extra {
+		out[k] = v
+	}
+	for k, v := range fixed {
+		out[k] = v
+	}
+	return json.Marshal(out)
+}
 
 type AuditEventEnvelope struct {
 	ID          int             `json:"ID"`
@@ -125,6 +295,20 @@ func (e *AuditEventEnvelope) UnmarshalJSON(b []byte) error {
 		delete(m, "Timestamp")
 	}
 
+	// ID beholdes også i Extra, slik den alltid har blitt videresendt
+	if v, ok := m["ID"]; ok {
+		var n json.Number
+		if err := json.Unmarshal(v, &n); err == nil {
+			id, _ := n.Int64()
+			e.ID = int(id)
+		} else {
+			var s string
+			if err := json.Unmarshal(v, &s); err == nil {
+				id, _ := strconv.Atoi(s)
+				e.ID = id
+			}
+		}
+	}
 	if v, ok := m["Message"]; ok {
 		_ = json.Unmarshal(v, &e.Message)
 		delete(m, "Message")
@@ -1,5 +1,7 @@
 package netbird
 
+import "time"
+
 type NetbirdUser struct {
 	ID        string `json:"id"`
 	Email     string `json:"email"`
@@ -8,8 +10,216 @@ type NetbirdUser struct {
 }
 
 type NetbirdPeer struct {
-	ID       string `json:"id"`
-	Hostname string `json:"hostname"`
-	IP       string `json:"ip"`
-	UserID   string `json:"user_id"`
+	ID               string                `json:"id"`
+	Name             string                `json:"name"`
+	Hostname         string                `json:"hostname"`
+	IP               string                `json:"ip"`
+	UserID           string                `json:"user_id"`
+	DNSLabel         string                `json:"dns_label"`
+	Groups           []NetbirdGroupMinimum `json:"groups"`
+	OS               string                `json:"os"`
+	KernelVersion    string                `json:"kernel_version"`
+	Version          string                `json:"version"`
+	Connected        bool                  `json:"connected"`
+	ConnectionIP     string                `json:"connection_ip"`
+	LastSeen         time.Time             `json:"last_seen"`
+	CountryCode      string                `json:"country_code"`
+	CityName         string                `json:"city_name"`
+	GeonameID        int                   `json:"geoname_id"`
+	ApprovalRequired bool                  `json:"approval_required"`
+}
+
+type NetbirdGroupMinimum struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// GroupNames returns the names of the groups the peer belongs to.
+func (p NetbirdPeer) GroupNames() []string {
+	names := make([]string, 0, len(p.Groups))
+	for _, g := range p.Groups {
+		names = append(names, g.Name)
+	}
+	return names
+}
+
+type NetbirdGroup struct {
+	ID             string               `json:"id"`
+	Name           string               `json:"name"`
+	PeersCount     int                  `json:"peers_count"`
+	ResourcesCount int                  `json:"resources_count"`
+	Issued         string               `json:"issued"`
+	Peers          []NetbirdPeerMinimum `json:"peers"`
+}
+
+type NetbirdPeerMinimum struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type NetbirdPolicy struct {
+	ID                  string              `json:"id"`
+	Name                string              `json:"name"`
+	Description         string              `json:"description"`
+	Enabled             bool                `json:"enabled"`
+	SourcePostureChecks []string            `json:"source_posture_checks"`
+	Rules               []NetbirdPolicyRule `json:"rules"`
+}
+
+type NetbirdPolicyRule struct {
+	ID            string                `json:"id"`
+	Name          string                `json:"name"`
+	Description   string                `json:"description"`
+	Enabled       bool                  `json:"enabled"`
+	Action        string                `json:"action"`
+	Bidirectional bool                  `json:"bidirectional"`
+	Protocol      string                `json:"protocol"`
+	Ports         []string              `json:"ports"`
+	Sources       []NetbirdGroupMinimum `json:"sources"`
+	Destinations  []NetbirdGroupMinimum `json:"destinations"`
+}
+
+type NetbirdRoute struct {
+	ID          string   `json:"id"`
+	NetworkID   string   `json:"network_id"`
+	Description string   `json:"description"`
+	Network     string   `json:"network"`
+	Domains     []string `json:"domains"`
+	Peer        string   `json:"peer"`
+	PeerGroups  []string `json:"peer_groups"`
+	Groups      []string `json:"groups"`
+	Metric      int      `json:"metric"`
+	Masquerade  bool     `json:"masquerade"`
+	Enabled     bool     `json:"enabled"`
+}
+
+type NetbirdNameserverGroup struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Nameservers []NetbirdNameserver `json:"nameservers"`
+	Groups      []string            `json:"groups"`
+	Domains     []string            `json:"domains"`
+	Primary     bool                `json:"primary"`
+	Enabled     bool                `json:"enabled"`
+}
+
+type NetbirdNameserver struct {
+	IP     string `json:"ip"`
+	NSType string `json:"ns_type"`
+	Port   int    `json:"port"`
+}
+
+type NetbirdPostureCheck struct {
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Checks      map[string]any `json:"checks"`
+}
+
+type NetbirdSetupKey struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	State      string   `json:"state"`
+	Valid      bool     `json:"valid"`
+	Revoked    bool     `json:"revoked"`
+	AutoGroups []string `json:"auto_groups"`
+	Ephemeral  bool     `json:"ephemeral"`
+}
+
+type NetbirdNetwork struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Routers     []string `json:"routers"`
+	Resources   []string `json:"resources"`
+	Policies    []string `json:"policies"`
+}
+
+type NetbirdNetworkResource struct {
+	ID          string                `json:"id"`
+	Name        string                `json:"name"`
+	Description string                `json:"description"`
+	Type        string                `json:"type"`
+	Address     string                `json:"address"`
+	Enabled     bool                  `json:"enabled"`
+	Groups      []NetbirdGroupMinimum `json:"groups"`
+	NetworkID   string                `json:"network_id"` // fylles inn av forwarderen
+	NetworkName string                `json:"network_name"`
+}
+
+type NetbirdAuditEvent struct {
+	ID             string         `json:"id"`
+	Timestamp      time.Time      `json:"timestamp"`
+	Activity       string         `json:"activity"`
+	ActivityCode   string         `json:"activity_code"`
+	InitiatorID    string         `json:"initiator_id"`
+	InitiatorName  string         `json:"initiator_name"`
+	InitiatorEmail string         `json:"initiator_email"`
+	TargetID       string         `json:"target_id"`
+	Meta           map[string]any `json:"meta"`
+}
+
+type NetbirdTrafficPage struct {
+	Data         []NetbirdTrafficFlow `json:"data"`
+	Page         int                  `json:"page"`
+	PageSize     int                  `json:"page_size"`
+	TotalRecords int                  `json:"total_records"`
+	TotalPages   int                  `json:"total_pages"`
+}
+
+type NetbirdTrafficFlow struct {
+	ID          string                   `json:"id"`
+	FlowID      string                   `json:"flow_id"`
+	ReporterID  string                   `json:"reporter_id"`
+	Source      NetbirdTrafficEndpoint   `json:"source"`
+	Destination NetbirdTrafficEndpoint   `json:"destination"`
+	User        NetbirdTrafficUser       `json:"user"`
+	Policy      NetbirdTrafficPolicy     `json:"policy"`
+	ICMP        NetbirdTrafficICMP       `json:"icmp"`
+	Protocol    int                      `json:"protocol"`
+	Direction   string                   `json:"direction"`
+	RxBytes     int                      `json:"rx_bytes"`
+	RxPackets   int                      `json:"rx_packets"`
+	TxBytes     int                      `json:"tx_bytes"`
+	TxPackets   int                      `json:"tx_packets"`
+	Events      []NetbirdTrafficFlowStep `json:"events"`
+}
+
+type NetbirdTrafficEndpoint struct {
+	ID          string             `json:"id"`
+	Type        string             `json:"type"`
+	Name        string             `json:"name"`
+	Address     string             `json:"address"`
+	DNSLabel    string             `json:"dns_label"`
+	OS          string             `json:"os"`
+	GeoLocation NetbirdGeoLocation `json:"geo_location"`
+}
+
+type NetbirdGeoLocation struct {
+	CityName    string `json:"city_name"`
+	CountryCode string `json:"country_code"`
+}
+
+type NetbirdTrafficUser struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type NetbirdTrafficPolicy struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type NetbirdTrafficICMP struct {
+	Type int `json:"type"`
+	Code int `json:"code"`
+}
+
+type NetbirdTrafficFlowStep struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
 }